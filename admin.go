@@ -0,0 +1,228 @@
+package sessions
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// ErrNotFound is returned for an unknown session, such as by
+// Inspector.Session and MemoryStore.Update, or by Save of server stores
+// when the loaded session expired or was evicted or destroyed meanwhile.
+var ErrNotFound = errors.New("sessions: session not found")
+
+// ReasonRevokedByAdmin is the reason of sessions deleted through the admin
+// handler.
+const ReasonRevokedByAdmin RevokeReason = "revoked by admin"
+
+// Inspector is implemented by stores that can iterate over their sessions.
+type Inspector interface {
+	// Sessions returns every live session.
+	Sessions() ([]SessionInfo, error)
+	// Session returns the live session of id with its encoded value.
+	Session(id string) (SessionInfo, string, error)
+}
+
+// AdminStore is a store the admin handler can inspect and revoke sessions
+// of, such as MemoryStore.
+type AdminStore interface {
+	Inspector
+	OwnerIndex
+	Revoker
+}
+
+// AdminOptions stores the configuration of the admin handler.
+type AdminOptions struct {
+	// Authorize reports whether r may use the admin API. Every request is
+	// refused when it is nil.
+	Authorize func(r *http.Request) bool
+	// Redact lists the session fields, at any depth and case insensitive,
+	// whose values are hidden when showing a session.
+	Redact []string
+}
+
+// NewAdminHandler returns an http.Handler serving a JSON API over store:
+//
+//	GET    /sessions?subject=id  list the sessions, of one subject if given
+//	GET    /sessions/{id}        show a session and its decoded content
+//	DELETE /sessions/{id}        revoke a session
+//	DELETE /sessions?subject=id  revoke every session of a subject
+//
+// Mount it with http.StripPrefix to serve it under another path.
+func NewAdminHandler(store AdminStore, adminOptions *AdminOptions) http.Handler {
+	aopts := AdminOptions{}
+	if adminOptions != nil {
+		aopts = *adminOptions
+	}
+	redact := make(map[string]bool, len(aopts.Redact))
+	for _, field := range aopts.Redact {
+		redact[strings.ToLower(field)] = true
+	}
+	return &adminHandler{store: store, aopts: aopts, redact: redact}
+}
+
+type adminHandler struct {
+	store  AdminStore
+	aopts  AdminOptions
+	redact map[string]bool
+}
+
+// adminSession is a session shown by the admin handler.
+type adminSession struct {
+	SessionInfo
+	Content interface{} `json:"content"`
+}
+
+func (a *adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if a.aopts.Authorize == nil || !a.aopts.Authorize(r) {
+		writeError(w, http.StatusForbidden, "forbidden")
+		return
+	}
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	id := strings.TrimPrefix(path, "/sessions/")
+	switch {
+	case path == "/sessions":
+		a.serveSessions(w, r)
+	case id != path && id != "" && !strings.Contains(id, "/"):
+		a.serveSession(w, r, id)
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (a *adminHandler) serveSessions(w http.ResponseWriter, r *http.Request) {
+	subject := r.URL.Query().Get("subject")
+	switch r.Method {
+	case "GET":
+		var infos []SessionInfo
+		var err error
+		if subject != "" {
+			infos, err = a.store.SessionsFor(subject)
+		} else {
+			infos, err = a.store.Sessions()
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if infos == nil {
+			infos = []SessionInfo{}
+		}
+		sort.Sort(&byActivity{infos: infos})
+		writeJSON(w, http.StatusOK, infos)
+	case "DELETE":
+		if subject == "" {
+			writeError(w, http.StatusBadRequest, "subject required")
+			return
+		}
+		infos, err := a.store.SessionsFor(subject)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		for _, info := range infos {
+			if err = a.store.Revoke(info.ID, ReasonRevokedByAdmin); err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"deleted": len(infos)})
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	}
+}
+
+func (a *adminHandler) serveSession(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Method != "GET" && r.Method != "DELETE" {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+	info, value, err := a.store.Session(id)
+	if err == ErrNotFound {
+		writeError(w, http.StatusNotFound, err.Error())
+		return
+	} else if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if r.Method == "DELETE" {
+		if err = a.store.Revoke(id, ReasonRevokedByAdmin); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	var content interface{}
+	if err = Decode(value, &content); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, adminSession{SessionInfo: info, Content: a.redacted(content)})
+}
+
+// redacted replaces the values of the redacted fields found in v.
+func (a *adminHandler) redacted(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if a.redact[strings.ToLower(key)] {
+				v[key] = "[REDACTED]"
+			} else {
+				v[key] = a.redacted(value)
+			}
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = a.redacted(value)
+		}
+	}
+	return v
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// Sessions returns every live session.
+func (m *MemoryStore) Sessions() ([]SessionInfo, error) {
+	if m.isClosed() {
+		return nil, ErrStoreClosed
+	}
+	var infos []SessionInfo
+	now := m.clock.Now()
+	for _, s := range m.shards {
+		s.lock.RLock()
+		for _, val := range s.store {
+			if val.expired.After(now) {
+				infos = append(infos, val.info())
+			}
+		}
+		s.lock.RUnlock()
+	}
+	return infos, nil
+}
+
+// Session returns the live session of id with its encoded value.
+func (m *MemoryStore) Session(id string) (info SessionInfo, value string, err error) {
+	if m.isClosed() {
+		return info, "", ErrStoreClosed
+	}
+	s := m.shard(id)
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	val, ok := s.store[id]
+	if !ok || !val.expired.After(m.clock.Now()) {
+		return info, "", ErrNotFound
+	}
+	value, _ = splitBinding(val.session)
+	return val.info(), value, nil
+}
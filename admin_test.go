@@ -0,0 +1,144 @@
+package sessions_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+// TokenSession is bound to a user and carries secrets.
+type TokenSession struct {
+	*sessions.Meta `json:"-"`
+	UserID         string            `json:"uid"`
+	Token          string            `json:"token"`
+	Extra          map[string]string `json:"extra"`
+}
+
+func (s *TokenSession) Save() error {
+	return s.GetStore().Save(s)
+}
+
+func (s *TokenSession) SubjectID() string {
+	return s.UserID
+}
+
+func TestAdminHandler(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	store := sessions.NewMemoryStore()
+	defer store.Close()
+
+	login := func(uid string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &TokenSession{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.UserID = uid
+			session.Token = "secret-" + uid
+			session.Extra = map[string]string{"Token": "nested", "theme": "dark"}
+			session.Save()
+		})
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	first := login("u1")
+	login("u1")
+	login("u2")
+
+	admin := sessions.NewAdminHandler(store, &sessions.AdminOptions{
+		Authorize: func(r *http.Request) bool {
+			return r.Header.Get("X-Admin-Token") == "admin"
+		},
+		Redact: []string{"token"},
+	})
+	serve := func(method, url string, v interface{}) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, url, nil)
+		req.Header.Set("X-Admin-Token", "admin")
+		recorder := httptest.NewRecorder()
+		admin.ServeHTTP(recorder, req)
+		if v != nil {
+			json.Unmarshal(recorder.Body.Bytes(), v)
+		}
+		return recorder
+	}
+
+	t.Run("AdminHandler authorization that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		req, _ := http.NewRequest("GET", "/sessions", nil)
+		recorder := httptest.NewRecorder()
+		admin.ServeHTTP(recorder, req)
+		assert.Equal(http.StatusForbidden, recorder.Code)
+
+		recorder = httptest.NewRecorder()
+		sessions.NewAdminHandler(store, nil).ServeHTTP(recorder, req)
+		assert.Equal(http.StatusForbidden, recorder.Code)
+	})
+
+	t.Run("AdminHandler list sessions that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		var infos []sessions.SessionInfo
+		recorder := serve("GET", "/sessions", &infos)
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal("application/json; charset=utf-8", recorder.Header().Get("Content-Type"))
+		assert.Equal(3, len(infos))
+
+		recorder = serve("GET", "/sessions?subject=u1", &infos)
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(2, len(infos))
+		assert.Equal("u1", infos[0].Subject)
+
+		assert.Equal(http.StatusNotFound, serve("GET", "/other", nil).Code)
+		assert.Equal(http.StatusMethodNotAllowed, serve("POST", "/sessions", nil).Code)
+	})
+
+	t.Run("AdminHandler show session that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		sid, _ := getCookie(SessionName, first)
+		var session struct {
+			ID      string                 `json:"id"`
+			Subject string                 `json:"subject"`
+			Content map[string]interface{} `json:"content"`
+		}
+		recorder := serve("GET", "/sessions/"+sid.Value, &session)
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(sid.Value, session.ID)
+		assert.Equal("u1", session.Subject)
+		assert.Equal("u1", session.Content["uid"])
+		assert.Equal("[REDACTED]", session.Content["token"])
+		assert.Equal(map[string]interface{}{"Token": "[REDACTED]", "theme": "dark"}, session.Content["extra"])
+		assert.NotContains(recorder.Body.String(), "secret-u1")
+
+		assert.Equal(http.StatusNotFound, serve("GET", "/sessions/unknown", nil).Code)
+	})
+
+	t.Run("AdminHandler delete sessions that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		sid, _ := getCookie(SessionName, first)
+		assert.Equal(http.StatusNoContent, serve("DELETE", "/sessions/"+sid.Value, nil).Code)
+		assert.Equal(http.StatusNotFound, serve("GET", "/sessions/"+sid.Value, nil).Code)
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		migrateCookies(first, req)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &TokenSession{Meta: &sessions.Meta{}}
+			err := store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Equal(&sessions.RevokedError{Reason: sessions.ReasonRevokedByAdmin}, err)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(http.StatusBadRequest, serve("DELETE", "/sessions", nil).Code)
+		var result map[string]int
+		recorder := serve("DELETE", "/sessions?subject=u1", &result)
+		assert.Equal(http.StatusOK, recorder.Code)
+		assert.Equal(1, result["deleted"])
+		assert.Equal(1, store.Len())
+	})
+}
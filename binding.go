@@ -0,0 +1,172 @@
+package sessions
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrBindingMismatch is returned by Load when the session is bound to
+// another client and the BindReject policy loaded it as a new session.
+var ErrBindingMismatch = errors.New("sessions: session bound to another client")
+
+// ErrReauthRequired is returned by Load when the session is bound to
+// another client and the BindReauth policy requires the user to sign in
+// again.
+var ErrReauthRequired = errors.New("sessions: re-authentication required")
+
+// BindingPolicy is what Load does with a session bound to another client.
+type BindingPolicy int
+
+const (
+	// BindReject loads the session as a new one and returns
+	// ErrBindingMismatch.
+	BindReject BindingPolicy = iota
+	// BindFlag loads the session and only flags it, see
+	// Meta.BindingMismatch.
+	BindFlag
+	// BindReauth loads the session flagged and returns ErrReauthRequired.
+	// Upgrading it after the user signed in again binds it to the client.
+	BindReauth
+)
+
+// Binding ties sessions to a fingerprint of the client that created them,
+// so that a stolen sid or cookie does not work from another machine. The
+// fingerprint is stored with the session value, and checked on Load when
+// the session's Meta carries the Binding and the request's Fingerprint.
+// Clients switching networks change their IP prefix, so BindFlag or
+// BindReauth are gentler for mobile users than BindReject.
+type Binding struct {
+	// UserAgent adds the User-Agent header to the fingerprint.
+	UserAgent bool
+	// IPv4Prefix and IPv6Prefix are the number of leading bits of the
+	// client address added to the fingerprint, such as 24 and 48. Zero
+	// leaves the address out.
+	IPv4Prefix int
+	IPv6Prefix int
+	// Parts returns custom parts added to the fingerprint, such as a
+	// device id header or the address found behind a trusted proxy.
+	Parts func(r *http.Request) []string
+	// Policy applies to sessions bound to another client.
+	Policy BindingPolicy
+}
+
+// Fingerprint returns the fingerprint of the client of r, as 32 hex chars.
+// The address is taken from r.RemoteAddr.
+func (b *Binding) Fingerprint(r *http.Request) string {
+	h := sha256.New()
+	write := func(kind, part string) {
+		h.Write([]byte(kind + "\x00" + part + "\x00"))
+	}
+	if b.UserAgent {
+		write("ua", r.UserAgent())
+	}
+	if ip := clientIP(r); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil && b.IPv4Prefix > 0 {
+			write("ip", ip4.Mask(net.CIDRMask(b.IPv4Prefix, 32)).String())
+		} else if ip4 == nil && b.IPv6Prefix > 0 {
+			write("ip", ip.Mask(net.CIDRMask(b.IPv6Prefix, 128)).String())
+		}
+	}
+	if b.Parts != nil {
+		for _, part := range b.Parts(r) {
+			write("part", part)
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil)[:16])
+}
+
+func clientIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// BindingMismatch reports whether the session was loaded from another
+// client than the one it is bound to, under BindFlag or BindReauth.
+func (s *Meta) BindingMismatch() bool {
+	return s.mismatch
+}
+
+func (s *Meta) setBound(fingerprint string, mismatch bool) {
+	s.bound, s.mismatch = fingerprint, mismatch
+}
+
+// boundFingerprint returns the fingerprint to store the session with: the
+// one it was loaded with, or the client's for new and unbound sessions.
+func (s *Meta) boundFingerprint() string {
+	if s.bound == "" && s.Binding != nil {
+		return s.Fingerprint
+	}
+	return s.bound
+}
+
+func (s *Meta) binding() (*Binding, string) {
+	return s.Binding, s.Fingerprint
+}
+
+// binder is implemented by sessions embedding Meta.
+type binder interface {
+	binding() (*Binding, string)
+	setBound(fingerprint string, mismatch bool)
+	boundFingerprint() string
+}
+
+// bind returns val as stored, suffixed with the fingerprint the session is
+// bound to. Encoded values never contain a '.'.
+func bind(session Sessions, val string) string {
+	if b, ok := session.(binder); ok {
+		if fingerprint := b.boundFingerprint(); fingerprint != "" {
+			return val + "." + fingerprint
+		}
+	}
+	return val
+}
+
+// splitBinding splits a stored value into the encoded value and the
+// fingerprint it is bound to, if any.
+func splitBinding(stored string) (val, fingerprint string) {
+	if i := strings.LastIndexByte(stored, '.'); i >= 0 {
+		return stored[:i], stored[i+1:]
+	}
+	return stored, ""
+}
+
+// unbind returns the encoded value of stored after checking its
+// fingerprint against the client of session, or "" if the binding policy
+// rejects it. Values stored without fingerprint get bound on next Save.
+func unbind(stored string, session Sessions) (string, error) {
+	val, fingerprint := splitBinding(stored)
+	b, ok := session.(binder)
+	if !ok {
+		return val, nil
+	}
+	binding, current := b.binding()
+	if binding == nil || fingerprint == "" ||
+		subtle.ConstantTimeCompare([]byte(fingerprint), []byte(current)) == 1 {
+		b.setBound(fingerprint, false)
+		return val, nil
+	}
+	switch binding.Policy {
+	case BindFlag:
+		b.setBound(fingerprint, true)
+		return val, nil
+	case BindReauth:
+		b.setBound(fingerprint, true)
+		return val, ErrReauthRequired
+	}
+	return "", ErrBindingMismatch
+}
+
+// rebind binds session to the current client, see Upgrade.
+func rebind(session Sessions) {
+	if b, ok := session.(binder); ok {
+		b.setBound("", false)
+	}
+}
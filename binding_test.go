@@ -0,0 +1,179 @@
+package sessions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBinding(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	client := func(addr, userAgent string) *http.Request {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		req.Header.Set("User-Agent", userAgent)
+		return req
+	}
+	serve := func(store sessions.Store, binding *sessions.Binding, req *http.Request, from *httptest.ResponseRecorder, fn func(session *Session, err error)) *httptest.ResponseRecorder {
+		req.Header.Del("Cookie")
+		if from != nil {
+			migrateCookies(from, req)
+		}
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			if binding != nil {
+				session.Binding, session.Fingerprint = binding, binding.Fingerprint(r)
+			}
+			err := store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			fn(session, err)
+		})
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	save := func(session *Session, err error) {
+		session.Name = username
+		session.Save()
+	}
+	owner := client("192.0.2.10:5000", "Firefox")
+	thief := client("198.51.100.7:5000", "Firefox")
+
+	t.Run("Binding.Fingerprint that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		binding := &sessions.Binding{UserAgent: true, IPv4Prefix: 24, IPv6Prefix: 48}
+		fingerprint := binding.Fingerprint(owner)
+		assert.Equal(32, len(fingerprint))
+		assert.Equal(fingerprint, binding.Fingerprint(client("192.0.2.99:6000", "Firefox")))
+		assert.NotEqual(fingerprint, binding.Fingerprint(client("192.0.3.10:5000", "Firefox")))
+		assert.NotEqual(fingerprint, binding.Fingerprint(client("192.0.2.10:5000", "Chrome")))
+
+		v6 := binding.Fingerprint(client("[2001:db8:1::1]:443", "Firefox"))
+		assert.Equal(v6, binding.Fingerprint(client("[2001:db8:1:ffff::2]:443", "Firefox")))
+		assert.NotEqual(v6, binding.Fingerprint(client("[2001:db8:2::1]:443", "Firefox")))
+
+		assert.Equal(fingerprint, (&sessions.Binding{UserAgent: true, IPv4Prefix: 24}).Fingerprint(owner))
+		assert.Equal((&sessions.Binding{}).Fingerprint(owner), (&sessions.Binding{}).Fingerprint(thief))
+
+		device := &sessions.Binding{UserAgent: true, Parts: func(r *http.Request) []string {
+			return []string{r.Header.Get("X-Device")}
+		}}
+		req := client("192.0.2.10:5000", "Firefox")
+		req.Header.Set("X-Device", "d1")
+		assert.NotEqual(device.Fingerprint(owner), device.Fingerprint(req))
+	})
+
+	t.Run("CookieStore BindReject that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.New()
+		binding := &sessions.Binding{UserAgent: true, IPv4Prefix: 24}
+		from := serve(store, binding, owner, nil, save)
+
+		serve(store, binding, thief, from, func(session *Session, err error) {
+			assert.Equal(sessions.ErrBindingMismatch, err)
+			assert.True(session.IsNew())
+			assert.Equal("", session.Name)
+		})
+		serve(store, binding, client("192.0.2.20:5000", "Firefox"), from, func(session *Session, err error) {
+			assert.Nil(err)
+			assert.False(session.BindingMismatch())
+			assert.Equal(username, session.Name)
+		})
+		// stores without Binding still read bound values
+		serve(store, nil, thief, from, func(session *Session, err error) {
+			assert.Nil(err)
+			assert.Equal(username, session.Name)
+		})
+	})
+
+	t.Run("MemoryStore BindFlag that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+		binding := &sessions.Binding{IPv4Prefix: 24, Policy: sessions.BindFlag}
+		from := serve(store, binding, owner, nil, save)
+
+		serve(store, binding, thief, from, func(session *Session, err error) {
+			assert.Nil(err)
+			assert.True(session.BindingMismatch())
+			assert.Equal(username, session.Name)
+			session.Age = useage
+			assert.Nil(session.Save())
+		})
+		// saving from another client keeps the session bound to its owner
+		serve(store, binding, owner, from, func(session *Session, err error) {
+			assert.Nil(err)
+			assert.False(session.BindingMismatch())
+			assert.Equal(useage, session.Age)
+		})
+		serve(store, binding, thief, from, func(session *Session, err error) {
+			assert.True(session.BindingMismatch())
+		})
+	})
+
+	t.Run("MemoryStore BindReauth with Upgrade that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+		binding := &sessions.Binding{UserAgent: true, IPv4Prefix: 24, Policy: sessions.BindReauth}
+		from := serve(store, binding, owner, nil, save)
+
+		upgraded := serve(store, binding, thief, from, func(session *Session, err error) {
+			assert.Equal(sessions.ErrReauthRequired, err)
+			assert.True(session.BindingMismatch())
+			assert.Equal(username, session.Name)
+			// the user signed in again
+			assert.Nil(sessions.Upgrade(session, nil, nil))
+		})
+		serve(store, binding, thief, upgraded, func(session *Session, err error) {
+			assert.Nil(err)
+			assert.False(session.BindingMismatch())
+			assert.Equal(username, session.Name)
+		})
+		serve(store, binding, owner, upgraded, func(session *Session, err error) {
+			assert.Equal(sessions.ErrReauthRequired, err)
+		})
+	})
+
+	t.Run("MemoryStore binding unbound sessions that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+		binding := &sessions.Binding{IPv4Prefix: 24}
+		from := serve(store, nil, owner, nil, save)
+
+		serve(store, binding, owner, from, func(session *Session, err error) {
+			assert.Nil(err)
+			session.Age = useage
+			assert.Nil(session.Save())
+		})
+		serve(store, binding, thief, from, func(session *Session, err error) {
+			assert.Equal(sessions.ErrBindingMismatch, err)
+		})
+	})
+
+	t.Run("TieredStore BindReject on cache hits that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		backend := sessions.NewMemoryStore()
+		defer backend.Close()
+		store := sessions.NewTieredStore(backend, nil)
+		defer store.Close()
+		binding := &sessions.Binding{UserAgent: true}
+		from := serve(store, binding, owner, nil, save)
+
+		serve(store, binding, client("", "curl"), from, func(session *Session, err error) {
+			assert.Equal(sessions.ErrBindingMismatch, err)
+			assert.True(session.IsNew())
+		})
+		serve(store, binding, owner, from, func(session *Session, err error) {
+			assert.Nil(err)
+			assert.Equal(username, session.Name)
+		})
+	})
+}
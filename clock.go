@@ -0,0 +1,39 @@
+package sessions
+
+import "time"
+
+// Clock is the source of time used by stores for expiry and sweeping,
+// so that tests can control it. See sessionstest.FakeClock.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTicker returns a Ticker delivering ticks every d.
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker is the subset of time.Ticker used by stores.
+type Ticker interface {
+	// C returns the channel the ticks are delivered on.
+	C() <-chan time.Time
+	// Stop turns off the ticker.
+	Stop()
+}
+
+// realClock is the default Clock, backed by the time package.
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
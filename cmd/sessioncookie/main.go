@@ -0,0 +1,181 @@
+// Command sessioncookie decodes, verifies and signs session cookies of
+// sessions.New, for debugging.
+//
+//	sessioncookie decode -name Sess -keys key1,key2 'Sess=eyJ...; Sess.sig=...'
+//	sessioncookie decode -name Sess -keys key1 -sig ... eyJ...
+//	sessioncookie sign -name Sess -keys key1 '{"userId":"x"}'
+//	sessioncookie keygen -n 2
+//
+// decode accepts a cookie value or a raw Cookie header and verifies the
+// signature as cookie.Get(name, true) does, unless -unsigned is set. sign
+// reads the payload from stdin when it is "-".
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+)
+
+const usage = `usage: sessioncookie <command> [flags] [arg]
+
+commands:
+  decode  verify and decode a cookie value or Cookie header
+  sign    encode and sign a JSON payload
+  keygen  generate random keys
+`
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, "sessioncookie:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer) error {
+	if len(args) == 0 {
+		return errors.New(usage)
+	}
+	switch args[0] {
+	case "decode":
+		return decode(args[1:], stdout)
+	case "sign":
+		return sign(args[1:], stdin, stdout)
+	case "keygen":
+		return keygen(args[1:], stdout)
+	}
+	return errors.New(usage)
+}
+
+func decode(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("decode", flag.ContinueOnError)
+	name := flags.String("name", "Sess", "cookie name")
+	keys := flags.String("keys", "", "comma separated signing keys, newest first")
+	sig := flags.String("sig", "", "signature, when the argument is a bare value")
+	unsigned := flags.Bool("unsigned", false, "skip signature verification")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("decode: one cookie value or Cookie header expected")
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	input := strings.TrimSpace(flags.Arg(0))
+	header := strings.HasPrefix(strings.ToLower(input), "cookie:")
+	if header {
+		input = strings.TrimSpace(input[len("cookie:"):])
+	}
+	if header || strings.Contains(input, *name+"=") {
+		req.Header.Set("Cookie", input)
+	} else {
+		req.AddCookie(&http.Cookie{Name: *name, Value: input})
+		if *sig != "" {
+			req.AddCookie(&http.Cookie{Name: *name + ".sig", Value: *sig})
+		}
+	}
+	if !*unsigned && *keys == "" {
+		return errors.New("decode: -keys required to verify the signature")
+	}
+
+	value, err := cookie.New(httptest.NewRecorder(), req, splitKeys(*keys)...).Get(*name, !*unsigned)
+	if err != nil {
+		return fmt.Errorf("decode: %v", err)
+	}
+	if i := strings.LastIndexByte(value, '.'); i >= 0 {
+		// drop the client fingerprint of bound sessions, see sessions.Binding
+		value = value[:i]
+	}
+	var payload interface{}
+	if err = sessions.Decode(value, &payload); err != nil {
+		return fmt.Errorf("decode: %v", err)
+	}
+	out, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(stdout, "%s\n", out)
+	return err
+}
+
+func sign(args []string, stdin io.Reader, stdout io.Writer) error {
+	flags := flag.NewFlagSet("sign", flag.ContinueOnError)
+	name := flags.String("name", "Sess", "cookie name")
+	keys := flags.String("keys", "", "comma separated signing keys, the first one signs")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		return errors.New("sign: one JSON payload expected")
+	}
+	if *keys == "" {
+		return errors.New("sign: -keys required")
+	}
+	payload := []byte(flags.Arg(0))
+	if flags.Arg(0) == "-" {
+		var err error
+		if payload, err = ioutil.ReadAll(stdin); err != nil {
+			return err
+		}
+	}
+	// json.RawMessage is validated and compacted by Encode
+	value, err := sessions.Encode(json.RawMessage(bytes.TrimSpace(payload)))
+	if err != nil {
+		return fmt.Errorf("sign: payload is not valid JSON: %v", err)
+	}
+
+	recorder := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/", nil)
+	cookie.New(recorder, req, splitKeys(*keys)...).Set(*name, value, &cookie.Options{Signed: true})
+	var pairs []string
+	for _, c := range recorder.Result().Cookies() {
+		pairs = append(pairs, c.Name+"="+c.Value)
+	}
+	_, err = fmt.Fprintf(stdout, "Cookie: %s\n", strings.Join(pairs, "; "))
+	return err
+}
+
+func keygen(args []string, stdout io.Writer) error {
+	flags := flag.NewFlagSet("keygen", flag.ContinueOnError)
+	n := flags.Int("n", 1, "number of keys")
+	size := flags.Int("size", 32, "random bytes per key")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *size < 16 {
+		return errors.New("keygen: -size must be at least 16")
+	}
+	for i := 0; i < *n; i++ {
+		b := make([]byte, *size)
+		if _, err := rand.Read(b); err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(stdout, base64.RawURLEncoding.EncodeToString(b)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitKeys(keys string) []string {
+	var result []string
+	for _, key := range strings.Split(keys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			result = append(result, key)
+		}
+	}
+	return result
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+type Session struct {
+	*sessions.Meta `json:"-"`
+	UserID         string `json:"userId"`
+}
+
+func TestSessionCookie(t *testing.T) {
+
+	t.Run("decode a cookie of sessions.New that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store := sessions.New()
+			store.Load("Sess", session, cookie.New(w, r, "key2", "key1"))
+			session.UserID = "x"
+			store.Save(session)
+		})
+		handler.ServeHTTP(recorder, req)
+		var pairs []string
+		for _, c := range recorder.Result().Cookies() {
+			pairs = append(pairs, c.Name+"="+c.Value)
+		}
+		header := "Cookie: " + strings.Join(pairs, "; ")
+
+		var out bytes.Buffer
+		assert.Nil(run([]string{"decode", "-keys", "key1,key2", header}, nil, &out))
+		assert.Equal("{\n  \"userId\": \"x\"\n}\n", out.String())
+
+		assert.NotNil(run([]string{"decode", "-keys", "other", header}, nil, &out))
+		assert.NotNil(run([]string{"decode", header}, nil, &out))
+
+		out.Reset()
+		value := recorder.Result().Cookies()[0].Value
+		assert.Nil(run([]string{"decode", "-unsigned", value}, nil, &out))
+		assert.Contains(out.String(), `"userId": "x"`)
+	})
+
+	t.Run("sign then decode that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		var signed bytes.Buffer
+		assert.Nil(run([]string{"sign", "-keys", "key", "-"}, strings.NewReader(`{"userId": "y"}`), &signed))
+		assert.True(strings.HasPrefix(signed.String(), "Cookie: Sess="))
+		assert.Contains(signed.String(), "Sess.sig=")
+
+		var out bytes.Buffer
+		assert.Nil(run([]string{"decode", "-keys", "key", signed.String()}, nil, &out))
+		assert.Equal("{\n  \"userId\": \"y\"\n}\n", out.String())
+
+		assert.NotNil(run([]string{"sign", "-keys", "key", "{invalid"}, nil, &out))
+		assert.NotNil(run([]string{"sign", `{"userId": "y"}`}, nil, &out))
+	})
+
+	t.Run("keygen that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		var out bytes.Buffer
+		assert.Nil(run([]string{"keygen", "-n", "2"}, nil, &out))
+		keys := strings.Fields(out.String())
+		assert.Equal(2, len(keys))
+		assert.Equal(43, len(keys[0]))
+		assert.NotEqual(keys[0], keys[1])
+
+		assert.NotNil(run([]string{"keygen", "-size", "8"}, nil, &out))
+		assert.NotNil(run(nil, nil, &out))
+		assert.NotNil(run([]string{"unknown"}, nil, &out))
+	})
+}
@@ -15,10 +15,17 @@ type Options struct {
 
 // New returns an CookieStore instance
 func New(options ...*Options) (store *CookieStore) {
+	store = &CookieStore{newCookieOptions(true, options)}
+	return
+}
+
+// newCookieOptions converts the optional Options into cookie.Options,
+// falling back to the package defaults when none is given.
+func newCookieOptions(signed bool, options []*Options) *cookie.Options {
 	opts := &cookie.Options{
 		Path:     "/",
 		HTTPOnly: true,
-		Signed:   true,
+		Signed:   signed,
 		MaxAge:   24 * 60 * 60,
 	}
 	if len(options) > 0 && options[0] != nil {
@@ -29,8 +36,7 @@ func New(options ...*Options) (store *CookieStore) {
 		opts.Secure = temp.Secure
 		opts.HTTPOnly = temp.HTTPOnly
 	}
-	store = &CookieStore{opts}
-	return
+	return opts
 }
 
 // CookieStore stores sessions using secure cookies.
@@ -40,26 +46,32 @@ type CookieStore struct {
 
 // Load a session by name and any kind of stores
 func (c *CookieStore) Load(name string, session Sessions, cookie *cookie.Cookies) error {
-	val, err := cookie.Get(name, c.opts.Signed)
-	if val != "" {
-		err = Decode(val, &session)
+	sid, err := cookie.Get(name, c.opts.Signed)
+	var val string
+	if sid != "" {
+		if val, err = decodeLoaded(sid, session); val == "" {
+			sid = ""
+		}
 	}
 	// should call Init even if err
-	session.Init(name, val, cookie, c, val)
+	session.Init(name, sid, cookie, c, val)
 	return err
 }
 
 // Save session to Response's cookie
 func (c *CookieStore) Save(session Sessions) (err error) {
-	val, err := Encode(session)
-	if err == nil && session.IsChanged(val) {
-		session.GetCookie().Set(session.GetName(), val, c.opts)
+	val, changed, err := encodeChanged(session)
+	if err == nil && changed {
+		session.GetCookie().Set(session.GetName(), bind(session, val), c.opts)
 	}
 	return
 }
 
 // Destroy destroy the session
 func (c *CookieStore) Destroy(session Sessions) (err error) {
+	if readOnly(session) {
+		return ErrReadOnly
+	}
 	session.GetCookie().Remove(session.GetName(), c.opts)
 	return
 }
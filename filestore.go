@@ -0,0 +1,310 @@
+package sessions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+)
+
+// tempPrefix marks files that are still being written by Save.
+const tempPrefix = ".tmp-"
+
+// FileOptions stores the configuration of a FileStore.
+type FileOptions struct {
+	// CleanInterval is how often expired files are removed, defaults to 1 second.
+	CleanInterval time.Duration
+	// Clock is the source of time for expiry, defaults to the system clock.
+	Clock Clock
+	// IDGenerator creates and validates sids, defaults to DefaultIDGenerator.
+	IDGenerator IDGenerator
+	// SIDHasher, when set, derives the file names from the sids with a
+	// secret key instead of a plain SHA-256.
+	SIDHasher *SIDHasher
+}
+
+// NewFileStore returns an FileStore instance which keeps every session as a
+// file in dir. The directory is created if it does not exist.
+func NewFileStore(dir string, options ...*Options) (store *FileStore, err error) {
+	return NewFileStoreWithOptions(dir, nil, options...)
+}
+
+// NewFileStoreWithOptions returns an FileStore instance configured by fileOptions.
+func NewFileStoreWithOptions(dir string, fileOptions *FileOptions, options ...*Options) (store *FileStore, err error) {
+	fopts := FileOptions{}
+	if fileOptions != nil {
+		fopts = *fileOptions
+	}
+	if fopts.CleanInterval <= 0 {
+		fopts.CleanInterval = time.Second
+	}
+	if fopts.Clock == nil {
+		fopts.Clock = realClock{}
+	}
+	if fopts.IDGenerator == nil {
+		fopts.IDGenerator = DefaultIDGenerator
+	}
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		return
+	}
+	store = &FileStore{
+		dir:     dir,
+		fopts:   fopts,
+		opts:    newCookieOptions(false, options), // signing not necessary
+		ticker:  fopts.Clock.NewTicker(fopts.CleanInterval),
+		done:    make(chan bool, 1),
+		stopped: make(chan struct{}),
+	}
+
+	go store.cleanCache()
+	return
+}
+
+type fileValue struct {
+	Expired time.Time `json:"expired"`
+	Session string    `json:"session"`
+}
+
+// FileStore using files in a directory to store sessions base on secure cookies.
+type FileStore struct {
+	dir     string
+	fopts   FileOptions
+	opts    *cookie.Options
+	ticker  Ticker
+	done    chan bool
+	stopped chan struct{}
+	// writers hold it shared while renaming, clean exclusively while
+	// removing, so that clean never removes a file Save just replaced
+	lock sync.RWMutex
+	// saveLocks serialize the check and write of loaded sessions, and
+	// their removal, by path.
+	// They only guard against Saves of the same process, stores sharing the
+	// directory across processes can still overwrite each other.
+	saveLocks [64]sync.Mutex
+	closeOnce sync.Once
+}
+
+// Load a session by name and any kind of stores
+func (f *FileStore) Load(name string, session Sessions, cookie *cookie.Cookies) error {
+	sid, err := readSID(cookie, name, f.opts, f.fopts.IDGenerator)
+	var result string
+	if sid != "" {
+		if val, e := f.read(f.path(sid)); e == nil && val.Expired.After(f.fopts.Clock.Now()) {
+			result = val.Session
+		}
+	}
+	if result != "" {
+		if result, err = decodeLoaded(result, session); result == "" {
+			sid = ""
+		}
+	}
+	session.Init(name, sid, cookie, f, result)
+	return err
+}
+
+// Save session to Response's cookie
+func (f *FileStore) Save(session Sessions) (err error) {
+	val, changed, err := encodeChanged(session)
+	if err != nil || !changed {
+		return
+	}
+	sid := session.GetSID()
+	if sid == "" {
+		if sid, err = f.fopts.IDGenerator.NewID(); err != nil {
+			return
+		}
+	}
+	path := f.path(sid)
+	if session.GetSID() != "" {
+		lock := f.saveLock(path)
+		lock.Lock()
+		defer lock.Unlock()
+		var stored string
+		if cur, e := f.read(path); e == nil && cur.Expired.After(f.fopts.Clock.Now()) {
+			stored = cur.Session
+		}
+		if err = checkStored(session, stored); err != nil {
+			return
+		}
+	}
+	err = f.write(path, &fileValue{
+		Session: bind(session, val),
+		Expired: f.fopts.Clock.Now().Add(time.Duration(f.opts.MaxAge) * time.Second),
+	})
+	if err != nil {
+		return
+	}
+	session.GetCookie().Set(session.GetName(), sid, f.opts)
+	return
+}
+
+// Destroy destroy the session
+func (f *FileStore) Destroy(session Sessions) (err error) {
+	if readOnly(session) {
+		return ErrReadOnly
+	}
+	sid := session.GetSID()
+	if sid != "" {
+		// wait for a Save between its check and write, so it can not
+		// bring the file back
+		path := f.path(sid)
+		lock := f.saveLock(path)
+		lock.Lock()
+		err = os.Remove(path)
+		lock.Unlock()
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	session.GetCookie().Remove(session.GetName(), f.opts)
+	return
+}
+
+// Len returns the number of session files in the directory
+func (f *FileStore) Len() int {
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return 0
+	}
+	var n int
+	for _, file := range files {
+		if !file.IsDir() && !strings.HasPrefix(file.Name(), tempPrefix) {
+			n++
+		}
+	}
+	return n
+}
+
+// Close stops the goroutine cleanCache thread and waits for it to exit. It
+// can be called more than once.
+func (f *FileStore) Close() {
+	f.closeOnce.Do(func() {
+		close(f.done)
+	})
+	<-f.stopped
+}
+
+// path maps sid to a file name, so that client-supplied ids never reach the
+// file system as-is.
+func (f *FileStore) path(sid string) string {
+	if f.fopts.SIDHasher != nil {
+		return filepath.Join(f.dir, f.fopts.SIDHasher.Hash(sid))
+	}
+	sum := sha256.Sum256([]byte(sid))
+	return filepath.Join(f.dir, hex.EncodeToString(sum[:]))
+}
+
+// saveLock returns the lock of path, picked by FNV-1a hash.
+func (f *FileStore) saveLock(path string) *sync.Mutex {
+	h := uint32(2166136261)
+	for i := 0; i < len(path); i++ {
+		h ^= uint32(path[i])
+		h *= 16777619
+	}
+	return &f.saveLocks[h%uint32(len(f.saveLocks))]
+}
+
+func (f *FileStore) read(path string) (val *fileValue, err error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	}
+	val = &fileValue{}
+	err = json.Unmarshal(b, val)
+	return
+}
+
+// write replaces path atomically by writing a temp file and renaming it.
+func (f *FileStore) write(path string, val *fileValue) (err error) {
+	b, err := json.Marshal(val)
+	if err != nil {
+		return
+	}
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	return writeFileAtomic(path, func(w io.Writer) (err error) {
+		_, err = w.Write(b)
+		return
+	})
+}
+
+// writeFileAtomic replaces path with what write produces, through a temp file
+// in the same directory that is renamed once complete.
+func writeFileAtomic(path string, write func(w io.Writer) error) (err error) {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), tempPrefix)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil {
+			os.Remove(tmp.Name())
+		}
+	}()
+	if err = write(tmp); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return
+	}
+	if err = tmp.Close(); err != nil {
+		return
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+func (f *FileStore) cleanCache() {
+	defer close(f.stopped)
+	defer f.ticker.Stop()
+	for {
+		select {
+		case now := <-f.ticker.C():
+			f.clean(now)
+		case <-f.done:
+			return
+		}
+	}
+}
+
+func (f *FileStore) clean(now time.Time) {
+	files, err := ioutil.ReadDir(f.dir)
+	if err != nil {
+		return
+	}
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(f.dir, file.Name())
+		if strings.HasPrefix(file.Name(), tempPrefix) {
+			// leftovers of an interrupted Save, aged by the file system's
+			// time rather than the Clock of the sessions
+			if file.ModTime().Add(time.Minute).Before(time.Now()) {
+				os.Remove(path)
+			}
+			continue
+		}
+		if val, err := f.read(path); err != nil || val.Expired.Before(now) {
+			f.remove(path, file)
+		}
+	}
+}
+
+// remove deletes the expired file at path, unless a Save replaced it since
+// info was listed.
+func (f *FileStore) remove(path string, info os.FileInfo) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	if current, err := os.Lstat(path); err == nil && os.SameFile(info, current) {
+		os.Remove(path)
+	}
+}
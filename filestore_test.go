@@ -0,0 +1,199 @@
+package sessions_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/go-http-utils/cookie-session/sessionstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFileStore(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	t.Run("FileStore use default options that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "sessions")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+
+		store, err := sessions.NewFileStore(dir)
+		assert.Nil(err)
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Age = useage
+			assert.Nil(session.Save())
+			assert.True(session.IsNew())
+		})
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(1, store.Len())
+
+		sid, _ := getCookie(SessionName, recorder)
+		_, err = os.Stat(filepath.Join(dir, sid.Value))
+		assert.True(os.IsNotExist(err))
+
+		//====== reuse session =====
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+
+			assert.Equal(username, session.Name)
+			assert.Equal(useage, session.Age)
+			assert.False(session.IsNew())
+			assert.Nil(session.Destroy())
+		})
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(0, store.Len())
+
+		//====== destroy session=====
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			err := store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.NotNil(err)
+			assert.True(session.IsNew())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("FileStore with expired sessions that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "sessions")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+
+		clock := sessionstest.NewFakeClock(time.Now())
+		store, err := sessions.NewFileStoreWithOptions(dir, &sessions.FileOptions{
+			Clock: clock,
+		}, &sessions.Options{
+			Path:     "/",
+			HTTPOnly: true,
+			MaxAge:   1,
+		})
+		assert.Nil(err)
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 10; i++ {
+				session := &Session{Meta: &sessions.Meta{}}
+				store.Load(genID(), session, cookie.New(w, r, SessionKeys...))
+				session.Name = username
+				assert.Nil(session.Save())
+			}
+		})
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(10, store.Len())
+
+		// temp files age by the file system's time, whatever the clock says
+		writing := filepath.Join(dir, ".tmp-writing")
+		leftover := filepath.Join(dir, ".tmp-leftover")
+		assert.Nil(ioutil.WriteFile(writing, nil, 0600))
+		assert.Nil(ioutil.WriteFile(leftover, nil, 0600))
+		old := time.Now().Add(-2 * time.Minute)
+		assert.Nil(os.Chtimes(leftover, old, old))
+
+		clock.Advance(time.Hour)
+		assert.True(eventually(func() bool { return store.Len() == 0 }))
+		assert.True(eventually(func() bool {
+			_, err := os.Stat(leftover)
+			return os.IsNotExist(err)
+		}))
+		_, err = os.Stat(writing)
+		assert.Nil(err)
+	})
+
+	t.Run("FileStore with parallel Save that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "sessions")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+
+		store, err := sessions.NewFileStore(dir)
+		assert.Nil(err)
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		load := func() *Session {
+			req, _ := http.NewRequest("GET", "/", nil)
+			migrateCookies(recorder, req)
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(httptest.NewRecorder(), req, SessionKeys...))
+			return session
+		}
+
+		first, second := load(), load()
+		first.Name = "first"
+		assert.Nil(first.Save())
+		second.Age = useage
+		assert.Equal(sessions.ErrConflict, second.Save())
+		assert.Equal("first", load().Name)
+
+		//====== Save after Destroy =====
+		first, second = load(), load()
+		assert.Nil(first.Destroy())
+		second.Name = "second"
+		assert.Equal(sessions.ErrNotFound, second.Save())
+		assert.Equal(0, store.Len())
+
+		//====== Save racing Destroy never brings the file back =====
+		for i := 0; i < 100; i++ {
+			recorder = httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+			first, second = load(), load()
+			second.Name = "second"
+			var wg sync.WaitGroup
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				second.Save()
+			}()
+			assert.Nil(first.Destroy())
+			wg.Wait()
+			assert.Equal(0, store.Len())
+		}
+	})
+
+	t.Run("FileStore Close twice that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "sessions")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+
+		store, err := sessions.NewFileStore(dir)
+		assert.Nil(err)
+		store.Close()
+		assert.NotPanics(store.Close)
+	})
+}
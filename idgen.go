@@ -0,0 +1,153 @@
+package sessions
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"strings"
+
+	"github.com/go-http-utils/cookie"
+)
+
+// ErrInvalidSID is returned by Load when the sid sent by the client is
+// rejected by the store's IDGenerator. The session is loaded as a new one.
+var ErrInvalidSID = errors.New("sessions: invalid sid")
+
+// IDGenerator creates and validates the session ids of server-side stores.
+type IDGenerator interface {
+	// NewID returns a new unique session id.
+	NewID() (string, error)
+	// Valid reports whether id could have been returned by NewID, it is
+	// checked before any store lookup.
+	Valid(id string) bool
+}
+
+// DefaultIDGenerator generates 256 bits random ids encoded in base64url.
+var DefaultIDGenerator IDGenerator = &RandomIDGenerator{Size: 32}
+
+// RandomIDGenerator generates ids of Size bytes from crypto/rand, encoded
+// in base64url without padding.
+type RandomIDGenerator struct {
+	Size int
+}
+
+// NewID returns a new random id.
+func (g *RandomIDGenerator) NewID() (string, error) {
+	b := make([]byte, g.Size)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Valid reports whether id has the right length and alphabet. The 64 hex
+// chars ids returned by NewSID are accepted too, so that existing sessions
+// survive an upgrade.
+func (g *RandomIDGenerator) Valid(id string) bool {
+	if len(id) == 64 && strings.Trim(id, "0123456789abcdef") == "" {
+		return true
+	}
+	return len(id) == base64.RawURLEncoding.EncodedLen(g.Size) && isURLSafe(id)
+}
+
+// PrefixedIDGenerator prepends Prefix, such as "sess_", to the ids of
+// Generator, which defaults to DefaultIDGenerator.
+type PrefixedIDGenerator struct {
+	Prefix    string
+	Generator IDGenerator
+}
+
+// NewID returns a new prefixed id.
+func (g *PrefixedIDGenerator) NewID() (string, error) {
+	id, err := generator(g.Generator).NewID()
+	if err != nil {
+		return "", err
+	}
+	return g.Prefix + id, nil
+}
+
+// Valid reports whether id has the prefix and a valid id after it.
+func (g *PrefixedIDGenerator) Valid(id string) bool {
+	return strings.HasPrefix(id, g.Prefix) && generator(g.Generator).Valid(id[len(g.Prefix):])
+}
+
+// NodeIDGenerator embeds Node in the ids of Generator as "<node>.<id>", so
+// that load balancers can route a session to the node holding it. Node
+// must be made of base64url chars only.
+type NodeIDGenerator struct {
+	Node      string
+	Generator IDGenerator
+}
+
+// NewID returns a new id carrying the node hint.
+func (g *NodeIDGenerator) NewID() (string, error) {
+	id, err := generator(g.Generator).NewID()
+	if err != nil {
+		return "", err
+	}
+	return g.Node + "." + id, nil
+}
+
+// Valid reports whether id carries a well-formed node hint, of any node,
+// followed by a valid id.
+func (g *NodeIDGenerator) Valid(id string) bool {
+	i := strings.IndexByte(id, '.')
+	return i > 0 && isURLSafe(id[:i]) && generator(g.Generator).Valid(id[i+1:])
+}
+
+// SignedIDGenerator appends an HMAC signature from Keyring to the ids of
+// Generator, so that forged or guessed ids are rejected without a lookup.
+type SignedIDGenerator struct {
+	Keyring   *Keyring
+	Generator IDGenerator
+}
+
+// NewID returns a new signed id.
+func (g *SignedIDGenerator) NewID() (string, error) {
+	id, err := generator(g.Generator).NewID()
+	if err != nil {
+		return "", err
+	}
+	return g.Keyring.Sign(id), nil
+}
+
+// Valid reports whether id is signed by one of the keys and valid.
+func (g *SignedIDGenerator) Valid(id string) bool {
+	value, ok := g.Keyring.Verify(id)
+	return ok && generator(g.Generator).Valid(value)
+}
+
+// NodeOf returns the node hint of an id generated by NodeIDGenerator.
+func NodeOf(id string) string {
+	if i := strings.IndexByte(id, '.'); i > 0 {
+		return id[:i]
+	}
+	return ""
+}
+
+func generator(g IDGenerator) IDGenerator {
+	if g == nil {
+		return DefaultIDGenerator
+	}
+	return g
+}
+
+func isURLSafe(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// readSID returns the sid of the cookie name, or ErrInvalidSID if ids
+// rejects it.
+func readSID(c *cookie.Cookies, name string, opts *cookie.Options, ids IDGenerator) (string, error) {
+	sid, err := c.Get(name, opts.Signed)
+	if sid != "" && !ids.Valid(sid) {
+		return "", ErrInvalidSID
+	}
+	return sid, err
+}
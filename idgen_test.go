@@ -0,0 +1,113 @@
+package sessions_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDGenerator(t *testing.T) {
+
+	t.Run("DefaultIDGenerator that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		id, err := sessions.DefaultIDGenerator.NewID()
+		assert.Nil(err)
+		assert.Equal(43, len(id))
+		assert.True(sessions.DefaultIDGenerator.Valid(id))
+
+		other, _ := sessions.DefaultIDGenerator.NewID()
+		assert.NotEqual(id, other)
+
+		assert.True(sessions.DefaultIDGenerator.Valid(sessions.NewSID("value")))
+		assert.False(sessions.DefaultIDGenerator.Valid(""))
+		assert.False(sessions.DefaultIDGenerator.Valid("../../etc/passwd"))
+		assert.False(sessions.DefaultIDGenerator.Valid(id[:42] + "!"))
+		assert.False(sessions.DefaultIDGenerator.Valid(id + "A"))
+	})
+
+	t.Run("PrefixedIDGenerator that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		g := &sessions.PrefixedIDGenerator{Prefix: "sess_"}
+		id, err := g.NewID()
+		assert.Nil(err)
+		assert.True(strings.HasPrefix(id, "sess_"))
+		assert.True(g.Valid(id))
+		assert.False(g.Valid(id[5:]))
+		assert.False(g.Valid("sess_xxx"))
+	})
+
+	t.Run("NodeIDGenerator that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		g := &sessions.NodeIDGenerator{
+			Node:      "eu-1",
+			Generator: &sessions.PrefixedIDGenerator{Prefix: "sess_"},
+		}
+		id, err := g.NewID()
+		assert.Nil(err)
+		assert.True(strings.HasPrefix(id, "eu-1.sess_"))
+		assert.True(g.Valid(id))
+		assert.Equal("eu-1", sessions.NodeOf(id))
+		assert.Equal("", sessions.NodeOf("nonode"))
+
+		assert.False(g.Valid(id[5:]))
+		assert.False(g.Valid("e u." + id[5:]))
+	})
+
+	t.Run("MemoryStore rejects malformed sid that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{
+			IDGenerator: &sessions.PrefixedIDGenerator{Prefix: "sess_"},
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "sess", Value: "forged"})
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			err := store.Load("sess", session, cookie.New(w, r))
+			assert.Equal(sessions.ErrInvalidSID, err)
+			assert.True(session.IsNew())
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		c, _ := getCookie("sess", recorder)
+		assert.True(strings.HasPrefix(c.Value, "sess_"))
+		assert.Equal(1, store.Len())
+	})
+
+	t.Run("FileStore with IDGenerator that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "sessions")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		store, err := sessions.NewFileStoreWithOptions(dir, &sessions.FileOptions{
+			IDGenerator: &sessions.PrefixedIDGenerator{Prefix: "sess_"},
+		})
+		assert.Nil(err)
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "sess", Value: "forged"})
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Equal(sessions.ErrInvalidSID, store.Load("sess", session, cookie.New(w, r)))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		c, _ := getCookie("sess", recorder)
+		assert.True(strings.HasPrefix(c.Value, "sess_"))
+	})
+}
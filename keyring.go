@@ -0,0 +1,60 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// ErrEmptyKeyring is returned by NewKeyring without keys or with an empty
+// key, which would sign nothing.
+var ErrEmptyKeyring = errors.New("sessions: keyring needs non-empty keys")
+
+// Keyring holds HMAC keys. The first key signs and every key verifies, so
+// keys can be rotated by prepending a new one and dropping the oldest once
+// the values it signed have expired.
+type Keyring struct {
+	keys [][]byte
+}
+
+// NewKeyring returns a Keyring signing with the first of keys, or
+// ErrEmptyKeyring if there is none or one is empty.
+func NewKeyring(keys ...[]byte) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, ErrEmptyKeyring
+	}
+	for _, key := range keys {
+		if len(key) == 0 {
+			return nil, ErrEmptyKeyring
+		}
+	}
+	return &Keyring{keys: keys}, nil
+}
+
+// Sign returns value followed by "." and its signature.
+func (k *Keyring) Sign(value string) string {
+	return value + "." + k.sign(k.keys[0], value)
+}
+
+// Verify returns the value of signed if any of the keys signed it.
+func (k *Keyring) Verify(signed string) (value string, ok bool) {
+	i := strings.LastIndexByte(signed, '.')
+	if i < 0 {
+		return "", false
+	}
+	value, sig := signed[:i], []byte(signed[i+1:])
+	for _, key := range k.keys {
+		if hmac.Equal(sig, []byte(k.sign(key, value))) {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+func (k *Keyring) sign(key []byte, value string) string {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(value))
+	return base64.RawURLEncoding.EncodeToString(h.Sum(nil))
+}
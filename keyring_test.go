@@ -0,0 +1,121 @@
+package sessions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyring(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	t.Run("Keyring with rotation that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		old, err := sessions.NewKeyring([]byte("old"))
+		assert.Nil(err)
+		signed := old.Sign("value")
+
+		value, ok := old.Verify(signed)
+		assert.True(ok)
+		assert.Equal("value", value)
+
+		rotated, _ := sessions.NewKeyring([]byte("new"), []byte("old"))
+		value, ok = rotated.Verify(signed)
+		assert.True(ok)
+		assert.Equal("value", value)
+		assert.NotEqual(signed, rotated.Sign("value"))
+
+		other, _ := sessions.NewKeyring([]byte("new"))
+		_, ok = other.Verify(signed)
+		assert.False(ok)
+		_, ok = old.Verify("value.forged")
+		assert.False(ok)
+		_, ok = old.Verify("value")
+		assert.False(ok)
+	})
+
+	t.Run("NewKeyring without keys that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		_, err := sessions.NewKeyring()
+		assert.Equal(sessions.ErrEmptyKeyring, err)
+		_, err = sessions.NewKeyring([]byte("new"), nil)
+		assert.Equal(sessions.ErrEmptyKeyring, err)
+	})
+
+	t.Run("MemoryStore with Keyring that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		keyring, err := sessions.NewKeyring([]byte("secret"))
+		assert.Nil(err)
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{
+			Keyring: keyring,
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal(username, session.Name)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(int64(0), store.Rejected())
+
+		//====== guessed sid =====
+		id, _ := sessions.DefaultIDGenerator.NewID()
+		req, _ = http.NewRequest("GET", "/", nil)
+		req.AddCookie(&http.Cookie{Name: SessionName, Value: id + ".guessed"})
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Equal(sessions.ErrInvalidSID, store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.True(session.IsNew())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(int64(1), store.Rejected())
+	})
+
+	t.Run("MemoryStore with SignSID that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{SignSID: true})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		sig, _ := getCookie(SessionName+".sig", recorder)
+		assert.NotNil(sig)
+
+		//====== sid signed by other keys =====
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.NotNil(store.Load(SessionName, session, cookie.New(w, r, "otherkey")))
+			assert.Equal("", session.Name)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(int64(1), store.Rejected())
+	})
+}
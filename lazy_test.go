@@ -0,0 +1,164 @@
+package sessions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLazySession(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	t.Run("CookieStore lazy loading that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.New()
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Save()
+		})
+		handler.ServeHTTP(recorder, req)
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		recorder = httptest.NewRecorder()
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{Lazy: true}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.False(session.IsNew())
+			assert.Equal("", session.Name)
+			assert.Nil(session.Save())
+
+			assert.Nil(session.Resolve())
+			assert.Equal(username, session.Name)
+			assert.Nil(session.Resolve())
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(0, len(recorder.Result().Cookies()))
+	})
+
+	t.Run("MemoryStore lazy creation that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{Lazy: true}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(0, store.Len())
+		assert.Equal(0, len(recorder.Result().Cookies()))
+
+		recorder = httptest.NewRecorder()
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{Lazy: true}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(1, store.Len())
+
+		//====== lazily loaded through a TieredStore =====
+		tiered := sessions.NewTieredStore(store, nil)
+		defer tiered.Close()
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{Lazy: true}}
+			assert.Nil(tiered.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Nil(session.Resolve())
+			assert.Equal(username, session.Name)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("MemoryStore write before Resolve that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{Lazy: true}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			session.Age = useage
+			assert.Equal(sessions.ErrWrittenBeforeResolve, session.Save())
+			// the write is not overwritten either
+			assert.Equal(sessions.ErrWrittenBeforeResolve, session.Resolve())
+			assert.Equal(useage, session.Age)
+			assert.Equal("", session.Name)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal(username, session.Name)
+			assert.Equal(int64(0), session.Age)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("MemoryStore lazy session with defaults that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{Lazy: true}, Age: useage}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Nil(session.Save())
+			assert.Nil(session.Resolve())
+			assert.Equal(username, session.Name)
+			session.Age = useage + 1
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal(username, session.Name)
+			assert.Equal(int64(useage+1), session.Age)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
@@ -0,0 +1,206 @@
+package sessions
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+)
+
+// ErrSessionLimit is returned by LimitedStore.Save when a subject already
+// has the maximum number of sessions and the policy is LimitReject.
+var ErrSessionLimit = errors.New("sessions: too many sessions")
+
+// RevokeReason tells the browser of a revoked session why it was revoked.
+type RevokeReason string
+
+// ReasonSignedOutElsewhere is the reason of sessions evicted by a
+// LimitedStore for a newer login of the same subject.
+const ReasonSignedOutElsewhere RevokeReason = "signed out elsewhere"
+
+// RevokedError is returned by Load for a session revoked by the store. The
+// session is loaded as a new one.
+type RevokedError struct {
+	Reason RevokeReason
+}
+
+func (e *RevokedError) Error() string {
+	return "sessions: session revoked: " + string(e.Reason)
+}
+
+// Revoker is implemented by stores that can destroy sessions on behalf of
+// another browser, Load reports the reason to the revoked one.
+type Revoker interface {
+	// Revoke destroys the session of id, as found in SessionInfo.
+	Revoke(id string, reason RevokeReason) error
+	// IDOf returns the SessionInfo id of sid.
+	IDOf(sid string) string
+}
+
+// RevocableStore is a Store indexing sessions by owner that can revoke
+// them, such as MemoryStore.
+type RevocableStore interface {
+	Store
+	OwnerIndex
+	Revoker
+}
+
+// LimitPolicy decides what happens when a subject logs in once more than
+// allowed.
+type LimitPolicy int
+
+const (
+	// LimitReject refuses the new session with ErrSessionLimit.
+	LimitReject LimitPolicy = iota
+	// LimitEvictOldest revokes the sessions created first.
+	LimitEvictOldest
+	// LimitEvictIdle revokes the sessions least recently active.
+	LimitEvictIdle
+)
+
+// LimitOptions stores the configuration of a LimitedStore.
+type LimitOptions struct {
+	// MaxSessions is the maximum number of concurrent sessions of a
+	// subject, 0 means no limit.
+	MaxSessions int
+	Policy      LimitPolicy
+}
+
+// LimitedStore limits the number of concurrent sessions per subject, see
+// Subjecter. The limit is checked when a session gets bound to a subject,
+// saving a session already counted for it is never refused.
+type LimitedStore struct {
+	RevocableStore
+	lopts LimitOptions
+	lock  sync.Mutex
+}
+
+// NewLimitedStore returns a LimitedStore instance in front of store.
+func NewLimitedStore(store RevocableStore, limitOptions *LimitOptions) *LimitedStore {
+	lopts := LimitOptions{}
+	if limitOptions != nil {
+		lopts = *limitOptions
+	}
+	return &LimitedStore{RevocableStore: store, lopts: lopts}
+}
+
+// Load a session from the underlying store, sessions loaded are saved
+// through the LimitedStore.
+func (l *LimitedStore) Load(name string, session Sessions, cookie *cookie.Cookies) error {
+	err := l.RevocableStore.Load(name, session, cookie)
+	attach(session, l)
+	return err
+}
+
+// Save session to the underlying store, after making room for it or
+// refusing it if its subject has too many sessions.
+func (l *LimitedStore) Save(session Sessions) error {
+	s, ok := session.(Subjecter)
+	if !ok || s.SubjectID() == "" || l.lopts.MaxSessions <= 0 {
+		return l.RevocableStore.Save(session)
+	}
+	subject := s.SubjectID()
+	id := ""
+	if sid := session.GetSID(); sid != "" {
+		id = l.IDOf(sid)
+	}
+	infos, err := l.SessionsFor(subject)
+	if err != nil {
+		return err
+	}
+	if counted(infos, id) {
+		return l.RevocableStore.Save(session)
+	}
+
+	// serialize logins so that concurrent ones can not exceed the limit
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if infos, err = l.SessionsFor(subject); err != nil {
+		return err
+	}
+	if n := len(infos) - l.lopts.MaxSessions + 1; n > 0 && !counted(infos, id) {
+		if l.lopts.Policy == LimitReject {
+			return ErrSessionLimit
+		}
+		sort.Sort(&byActivity{infos: infos, idle: l.lopts.Policy == LimitEvictIdle})
+		for _, info := range infos[:n] {
+			if err = l.Revoke(info.ID, ReasonSignedOutElsewhere); err != nil {
+				return err
+			}
+		}
+	}
+	return l.RevocableStore.Save(session)
+}
+
+// revocation is what MemoryStore remembers of a revoked session.
+type revocation struct {
+	reason  RevokeReason
+	expired time.Time
+}
+
+// Revoke destroys the session of id, Load reports reason to its browser
+// until the session would have expired.
+func (m *MemoryStore) Revoke(id string, reason RevokeReason) error {
+	if m.isClosed() {
+		return ErrStoreClosed
+	}
+	s := m.shard(id)
+	s.lock.Lock()
+	if val, ok := s.store[id]; ok {
+		m.remove(s, val)
+		s.revoked[id] = revocation{reason: reason, expired: val.expired}
+	}
+	s.lock.Unlock()
+	return nil
+}
+
+// IDOf returns the SessionInfo id of sid.
+func (m *MemoryStore) IDOf(sid string) string {
+	return storageKey(m.mopts.SIDHasher, sid)
+}
+
+// revocation returns the revocation of key if it is still reported by now.
+// s.lock must be held.
+func (s *memoryShard) revocation(key string, now time.Time) *revocation {
+	if r, ok := s.revoked[key]; ok && r.expired.After(now) {
+		return &r
+	}
+	return nil
+}
+
+func counted(infos []SessionInfo, id string) bool {
+	for _, info := range infos {
+		if info.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// byActivity orders sessions by creation time, or by last activity when
+// idle is set, oldest first.
+type byActivity struct {
+	infos []SessionInfo
+	idle  bool
+}
+
+func (b *byActivity) Len() int {
+	return len(b.infos)
+}
+
+func (b *byActivity) Less(i, j int) bool {
+	return b.time(i).Before(b.time(j))
+}
+
+func (b *byActivity) Swap(i, j int) {
+	b.infos[i], b.infos[j] = b.infos[j], b.infos[i]
+}
+
+func (b *byActivity) time(i int) time.Time {
+	if b.idle {
+		return b.infos[i].Accessed
+	}
+	return b.infos[i].Created
+}
@@ -0,0 +1,119 @@
+package sessions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/go-http-utils/cookie-session/sessionstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimitedStore(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	login := func(store sessions.Store, uid string) (recorder *httptest.ResponseRecorder, err error) {
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder = httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &UserSession{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.UserID = uid
+			err = session.Save()
+		})
+		handler.ServeHTTP(recorder, req)
+		return
+	}
+	load := func(store sessions.Store, from *httptest.ResponseRecorder) (session *UserSession, err error) {
+		req, _ := http.NewRequest("GET", "/", nil)
+		migrateCookies(from, req)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session = &UserSession{Meta: &sessions.Meta{}}
+			err = store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return
+	}
+
+	t.Run("LimitedStore with LimitReject that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		memory := sessions.NewMemoryStore()
+		defer memory.Close()
+		store := sessions.NewLimitedStore(memory, &sessions.LimitOptions{MaxSessions: 2})
+
+		first, err := login(store, "u1")
+		assert.Nil(err)
+		_, err = login(store, "u1")
+		assert.Nil(err)
+		_, err = login(store, "u1")
+		assert.Equal(sessions.ErrSessionLimit, err)
+		_, err = login(store, "u2")
+		assert.Nil(err)
+		assert.Equal(3, memory.Len())
+
+		//====== counted session is saved again =====
+		session, err := load(store, first)
+		assert.Nil(err)
+		assert.Equal("u1", session.UserID)
+		session.UserID = "u1"
+		assert.Nil(session.Save())
+	})
+
+	t.Run("LimitedStore with LimitEvictOldest that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		clock := sessionstest.NewFakeClock(time.Now())
+		memory := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{Clock: clock})
+		defer memory.Close()
+		store := sessions.NewLimitedStore(memory, &sessions.LimitOptions{
+			MaxSessions: 2,
+			Policy:      sessions.LimitEvictOldest,
+		})
+
+		first, _ := login(store, "u1")
+		clock.Advance(time.Second)
+		second, _ := login(store, "u1")
+		clock.Advance(time.Second)
+		_, err := login(store, "u1")
+		assert.Nil(err)
+		infos, _ := store.SessionsFor("u1")
+		assert.Equal(2, len(infos))
+
+		session, err := load(store, first)
+		assert.Equal(&sessions.RevokedError{Reason: sessions.ReasonSignedOutElsewhere}, err)
+		assert.True(session.IsNew())
+		assert.Equal("", session.UserID)
+
+		session, err = load(store, second)
+		assert.Nil(err)
+		assert.Equal("u1", session.UserID)
+	})
+
+	t.Run("LimitedStore with LimitEvictIdle that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		clock := sessionstest.NewFakeClock(time.Now())
+		memory := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{Clock: clock})
+		defer memory.Close()
+		store := sessions.NewLimitedStore(memory, &sessions.LimitOptions{
+			MaxSessions: 2,
+			Policy:      sessions.LimitEvictIdle,
+		})
+
+		first, _ := login(store, "u1")
+		clock.Advance(time.Second)
+		second, _ := login(store, "u1")
+		clock.Advance(time.Second)
+		load(store, first)
+		clock.Advance(time.Second)
+		login(store, "u1")
+
+		_, err := load(store, first)
+		assert.Nil(err)
+		_, err = load(store, second)
+		assert.Equal(&sessions.RevokedError{Reason: sessions.ReasonSignedOutElsewhere}, err)
+	})
+}
@@ -0,0 +1,131 @@
+package sessions
+
+import (
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrLockTimeout is returned by Locker.Lock when the lock is still held by
+// another request after the timeout.
+var ErrLockTimeout = errors.New("sessions: lock timeout")
+
+// Locker serializes the requests sharing a session. MemoryLocker works
+// within one process, other implementations can be backed by a
+// distributed lock.
+type Locker interface {
+	// Lock blocks until the lock of key is held, or returns ErrLockTimeout
+	// after timeout. unlock releases it and may be called more than once.
+	Lock(key string, timeout time.Duration) (unlock func(), err error)
+}
+
+// MemoryLocker is a Locker for the requests served by one process.
+type MemoryLocker struct {
+	lock  sync.Mutex
+	locks map[string]*keyLock
+}
+
+// keyLock is a one slot semaphore, dropped once nobody holds or waits for it.
+type keyLock struct {
+	sem  chan struct{}
+	refs int
+}
+
+// NewMemoryLocker returns a MemoryLocker instance.
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{locks: make(map[string]*keyLock)}
+}
+
+// Lock blocks until the lock of key is held or timeout elapses.
+func (l *MemoryLocker) Lock(key string, timeout time.Duration) (func(), error) {
+	l.lock.Lock()
+	k, ok := l.locks[key]
+	if !ok {
+		k = &keyLock{sem: make(chan struct{}, 1)}
+		l.locks[key] = k
+	}
+	k.refs++
+	l.lock.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case k.sem <- struct{}{}:
+		var once sync.Once
+		return func() {
+			once.Do(func() {
+				<-k.sem
+				l.release(key, k)
+			})
+		}, nil
+	case <-timer.C:
+		l.release(key, k)
+		return nil, ErrLockTimeout
+	}
+}
+
+func (l *MemoryLocker) release(key string, k *keyLock) {
+	l.lock.Lock()
+	if k.refs--; k.refs == 0 {
+		delete(l.locks, key)
+	}
+	l.lock.Unlock()
+}
+
+// LockOptions stores the configuration of NewLockHandler.
+type LockOptions struct {
+	// Locker defaults to a new MemoryLocker.
+	Locker Locker
+	// Timeout is how long a request waits for the lock before it is
+	// answered with 503 Service Unavailable, defaults to 5 seconds.
+	Timeout time.Duration
+	// ReadOnly reports whether r only reads the session and can skip the
+	// lock, defaults to GET, HEAD and OPTIONS requests.
+	ReadOnly func(r *http.Request) bool
+	// MarkReadOnly marks the requests skipping the lock because of ReadOnly
+	// for IsReadOnly, so that handlers can load their sessions read-only.
+	MarkReadOnly bool
+}
+
+// NewLockHandler returns an http.Handler serializing the requests to next
+// that carry the same sid in the cookie name: the lock is taken before
+// next Loads the session and released after it Saved it. Requests without
+// the cookie, and read-only ones, are not serialized.
+func NewLockHandler(next http.Handler, name string, lockOptions *LockOptions) http.Handler {
+	lopts := LockOptions{}
+	if lockOptions != nil {
+		lopts = *lockOptions
+	}
+	if lopts.Locker == nil {
+		lopts.Locker = NewMemoryLocker()
+	}
+	if lopts.Timeout <= 0 {
+		lopts.Timeout = 5 * time.Second
+	}
+	if lopts.ReadOnly == nil {
+		lopts.ReadOnly = isSafeMethod
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if lopts.MarkReadOnly && lopts.ReadOnly(r) {
+			next.ServeHTTP(w, WithReadOnly(r))
+			return
+		}
+		c, err := r.Cookie(name)
+		if err != nil || c.Value == "" || lopts.ReadOnly(r) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		unlock, err := lopts.Locker.Lock(c.Value, lopts.Timeout)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		defer unlock()
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isSafeMethod(r *http.Request) bool {
+	return r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS"
+}
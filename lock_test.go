@@ -0,0 +1,97 @@
+package sessions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocker(t *testing.T) {
+
+	t.Run("MemoryLocker that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		locker := sessions.NewMemoryLocker()
+		unlock, err := locker.Lock("sid", time.Second)
+		assert.Nil(err)
+
+		_, err = locker.Lock("sid", 10*time.Millisecond)
+		assert.Equal(sessions.ErrLockTimeout, err)
+		other, err := locker.Lock("other", 10*time.Millisecond)
+		assert.Nil(err)
+		other()
+
+		done := make(chan struct{})
+		go func() {
+			unlock, err := locker.Lock("sid", time.Second)
+			assert.Nil(err)
+			unlock()
+			close(done)
+		}()
+		unlock()
+		unlock()
+		<-done
+	})
+
+	t.Run("NewLockHandler that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		var inside, most int32
+		release := make(chan struct{})
+		handler := sessions.NewLockHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n := atomic.AddInt32(&inside, 1)
+			if n > atomic.LoadInt32(&most) {
+				atomic.StoreInt32(&most, n)
+			}
+			<-release
+			atomic.AddInt32(&inside, -1)
+		}), "sess", &sessions.LockOptions{Timeout: time.Second})
+
+		serve := func(method string, wg *sync.WaitGroup) {
+			defer wg.Done()
+			req, _ := http.NewRequest(method, "/", nil)
+			req.AddCookie(&http.Cookie{Name: "sess", Value: "sid"})
+			handler.ServeHTTP(httptest.NewRecorder(), req)
+		}
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go serve("POST", &wg)
+		go serve("POST", &wg)
+		assert.True(eventually(func() bool { return atomic.LoadInt32(&inside) == 1 }))
+		time.Sleep(20 * time.Millisecond)
+		assert.Equal(int32(1), atomic.LoadInt32(&inside))
+		release <- struct{}{}
+		release <- struct{}{}
+		wg.Wait()
+		assert.Equal(int32(1), atomic.LoadInt32(&most))
+
+		//====== read-only requests are not serialized =====
+		wg.Add(2)
+		go serve("GET", &wg)
+		go serve("GET", &wg)
+		assert.True(eventually(func() bool { return atomic.LoadInt32(&inside) == 2 }))
+		close(release)
+		wg.Wait()
+	})
+
+	t.Run("NewLockHandler timeout that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		locker := sessions.NewMemoryLocker()
+		unlock, _ := locker.Lock("sid", time.Second)
+		defer unlock()
+
+		handler := sessions.NewLockHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			t.Error("should not be served")
+		}), "sess", &sessions.LockOptions{Locker: locker, Timeout: 10 * time.Millisecond})
+		req, _ := http.NewRequest("POST", "/", nil)
+		req.AddCookie(&http.Cookie{Name: "sess", Value: "sid"})
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(http.StatusServiceUnavailable, recorder.Code)
+	})
+}
@@ -0,0 +1,222 @@
+package sessions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// errCacheMiss is returned by memcacheConn when the key does not exist.
+var errCacheMiss = errors.New("sessions: memcache cache miss")
+
+// MemcacheError is an error reply sent by the memcached server.
+type MemcacheError string
+
+func (e MemcacheError) Error() string {
+	return string(e)
+}
+
+// memcacheConn is a single connection speaking the memcached text protocol.
+type memcacheConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	timeout time.Duration
+}
+
+func dialMemcache(addr string, timeout time.Duration) (*memcacheConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &memcacheConn{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		timeout: timeout,
+	}, nil
+}
+
+func (c *memcacheConn) get(key string) (val string, err error) {
+	val, _, err = c.retrieve("get", key)
+	return
+}
+
+// gets is get returning the cas unique of the value too.
+func (c *memcacheConn) gets(key string) (val string, unique uint64, err error) {
+	return c.retrieve("gets", key)
+}
+
+func (c *memcacheConn) retrieve(cmd, key string) (val string, unique uint64, err error) {
+	if err = c.send("%s %s\r\n", cmd, key); err != nil {
+		return
+	}
+	line, err := c.readLine()
+	if err != nil {
+		return
+	}
+	if line == "END" {
+		return "", 0, errCacheMiss
+	}
+	// VALUE <key> <flags> <bytes> [<cas unique>]
+	fields := strings.Fields(line)
+	want := 4
+	if cmd == "gets" {
+		want = 5
+	}
+	if len(fields) != want || fields[0] != "VALUE" {
+		return "", 0, replyError(line)
+	}
+	n, err := strconv.Atoi(fields[3])
+	if err != nil {
+		return
+	}
+	if cmd == "gets" {
+		if unique, err = strconv.ParseUint(fields[4], 10, 64); err != nil {
+			return
+		}
+	}
+	buf := make([]byte, n+2)
+	if _, err = io.ReadFull(c.r, buf); err != nil {
+		return
+	}
+	if line, err = c.readLine(); err != nil {
+		return
+	}
+	if line != "END" {
+		return "", 0, replyError(line)
+	}
+	return string(buf[:n]), unique, nil
+}
+
+func (c *memcacheConn) set(key, val string, exptime int64) error {
+	if err := c.send("set %s 0 %d %d\r\n%s\r\n", key, exptime, len(val), val); err != nil {
+		return err
+	}
+	return c.expect("STORED")
+}
+
+// add stores val only if key does not exist, or returns ErrConflict.
+func (c *memcacheConn) add(key, val string, exptime int64) error {
+	if err := c.send("add %s 0 %d %d\r\n%s\r\n", key, exptime, len(val), val); err != nil {
+		return err
+	}
+	return c.expect("STORED")
+}
+
+// cas stores val only if key still has the cas unique returned by gets,
+// or returns ErrConflict, or errCacheMiss if key is gone.
+func (c *memcacheConn) cas(key, val string, exptime int64, unique uint64) error {
+	if err := c.send("cas %s 0 %d %d %d\r\n%s\r\n", key, exptime, len(val), unique, val); err != nil {
+		return err
+	}
+	return c.expect("STORED")
+}
+
+func (c *memcacheConn) touch(key string, exptime int64) error {
+	if err := c.send("touch %s %d\r\n", key, exptime); err != nil {
+		return err
+	}
+	return c.expect("TOUCHED")
+}
+
+func (c *memcacheConn) delete(key string) error {
+	if err := c.send("delete %s\r\n", key); err != nil {
+		return err
+	}
+	return c.expect("DELETED")
+}
+
+func (c *memcacheConn) send(format string, args ...interface{}) error {
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	fmt.Fprintf(c.w, format, args...)
+	return c.w.Flush()
+}
+
+func (c *memcacheConn) expect(want string) error {
+	line, err := c.readLine()
+	if err != nil {
+		return err
+	}
+	switch line {
+	case want:
+		return nil
+	case "NOT_FOUND":
+		return errCacheMiss
+	case "EXISTS", "NOT_STORED":
+		return ErrConflict
+	}
+	return replyError(line)
+}
+
+func (c *memcacheConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+func (c *memcacheConn) Close() error {
+	return c.conn.Close()
+}
+
+func replyError(line string) error {
+	return MemcacheError("sessions: unexpected memcache reply " + strconv.Quote(line))
+}
+
+// hashRing spreads keys across servers with consistent hashing, so that
+// adding or removing a server only moves the keys of its neighbours.
+type hashRing struct {
+	points  ringPoints
+	servers map[uint32]string
+}
+
+// ringPoints sorts the points of a hashRing, sort.Slice needs Go 1.8.
+type ringPoints []uint32
+
+func (p ringPoints) Len() int {
+	return len(p)
+}
+
+func (p ringPoints) Less(i, j int) bool {
+	return p[i] < p[j]
+}
+
+func (p ringPoints) Swap(i, j int) {
+	p[i], p[j] = p[j], p[i]
+}
+
+// replicas is the number of virtual nodes per server on the ring.
+const replicas = 160
+
+func newHashRing(servers []string) *hashRing {
+	ring := &hashRing{servers: make(map[uint32]string)}
+	for _, server := range servers {
+		for i := 0; i < replicas; i++ {
+			point := crc32.ChecksumIEEE([]byte(server + "#" + strconv.Itoa(i)))
+			ring.points = append(ring.points, point)
+			ring.servers[point] = server
+		}
+	}
+	sort.Sort(ring.points)
+	return ring
+}
+
+func (h *hashRing) get(key string) string {
+	point := crc32.ChecksumIEEE([]byte(key))
+	i := sort.Search(len(h.points), func(i int) bool { return h.points[i] >= point })
+	if i == len(h.points) {
+		i = 0
+	}
+	return h.servers[h.points[i]]
+}
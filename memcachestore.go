@@ -0,0 +1,228 @@
+package sessions
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+)
+
+// MemcacheOptions stores the connection configuration of a MemcacheStore.
+type MemcacheOptions struct {
+	// Servers are the memcached server addresses, defaults to "127.0.0.1:11211".
+	Servers []string
+	// Prefix is prepended to every key.
+	Prefix string
+	// PoolSize is the maximum number of idle connections kept per server, defaults to 10.
+	PoolSize int
+	// Timeout is used for dialing and for every command, defaults to 5 seconds.
+	Timeout time.Duration
+	// Rolling refreshes the expiry of a session with touch every time it is loaded.
+	Rolling bool
+	// IDGenerator creates and validates sids, defaults to DefaultIDGenerator.
+	IDGenerator IDGenerator
+	// SIDHasher, when set, derives the keys from the sids with a secret key
+	// instead of a plain SHA-256.
+	SIDHasher *SIDHasher
+}
+
+// NewMemcacheStore returns an MemcacheStore instance
+func NewMemcacheStore(memcacheOptions *MemcacheOptions, options ...*Options) (store *MemcacheStore) {
+	mopts := MemcacheOptions{}
+	if memcacheOptions != nil {
+		mopts = *memcacheOptions
+	}
+	if len(mopts.Servers) == 0 {
+		mopts.Servers = []string{"127.0.0.1:11211"}
+	}
+	if mopts.PoolSize <= 0 {
+		mopts.PoolSize = 10
+	}
+	if mopts.Timeout <= 0 {
+		mopts.Timeout = 5 * time.Second
+	}
+	if mopts.IDGenerator == nil {
+		mopts.IDGenerator = DefaultIDGenerator
+	}
+	store = &MemcacheStore{
+		mopts: mopts,
+		opts:  newCookieOptions(false, options), // signing not necessary
+		ring:  newHashRing(mopts.Servers),
+		pools: make(map[string]chan *memcacheConn),
+	}
+	for _, server := range mopts.Servers {
+		store.pools[server] = make(chan *memcacheConn, mopts.PoolSize)
+	}
+	return
+}
+
+// MemcacheStore using memcached to store sessions base on secure cookies.
+type MemcacheStore struct {
+	mopts MemcacheOptions
+	opts  *cookie.Options
+	ring  *hashRing
+	pools map[string]chan *memcacheConn
+}
+
+// Load a session by name and any kind of stores
+func (m *MemcacheStore) Load(name string, session Sessions, cookie *cookie.Cookies) error {
+	sid, err := readSID(cookie, name, m.opts, m.mopts.IDGenerator)
+	var result string
+	if sid != "" {
+		key := m.key(sid)
+		e := m.do(key, func(c *memcacheConn) (err error) {
+			if result, err = c.get(key); err == nil && m.mopts.Rolling && !readOnly(session) {
+				err = c.touch(key, m.exptime())
+			}
+			return
+		})
+		if e != nil && e != errCacheMiss {
+			err = e
+		}
+	}
+	if result != "" {
+		if result, err = decodeLoaded(result, session); result == "" {
+			sid = ""
+		}
+	}
+	session.Init(name, sid, cookie, m, result)
+	return err
+}
+
+// Save session to Response's cookie
+func (m *MemcacheStore) Save(session Sessions) (err error) {
+	val, changed, err := encodeChanged(session)
+	if err != nil {
+		return
+	}
+	if !changed {
+		if m.mopts.Rolling && !session.IsNew() && !readOnly(session) {
+			// the key was touched by Load, keep the cookie in step
+			session.GetCookie().Set(session.GetName(), session.GetSID(), m.opts)
+		}
+		return
+	}
+	sid := session.GetSID()
+	_, raw := session.(*rawSession)
+	if sid == "" {
+		if sid, err = m.mopts.IDGenerator.NewID(); err != nil {
+			return
+		}
+		raw = true
+	}
+	key := m.key(sid)
+	err = m.do(key, func(c *memcacheConn) error {
+		if raw {
+			return c.set(key, bind(session, val), m.exptime())
+		}
+		return m.setChecked(c, session, key, bind(session, val))
+	})
+	if err != nil {
+		return
+	}
+	session.GetCookie().Set(session.GetName(), sid, m.opts)
+	return
+}
+
+// setChecked replaces the loaded session at key with gets and cas,
+// returning ErrConflict if another Save won the race, see checkStored.
+func (m *MemcacheStore) setChecked(c *memcacheConn, session Sessions, key, val string) error {
+	stored, unique, err := c.gets(key)
+	if err != nil && err != errCacheMiss {
+		return err
+	}
+	if err = checkStored(session, stored); err != nil {
+		return err
+	}
+	if stored == "" {
+		return c.add(key, val, m.exptime())
+	}
+	if err = c.cas(key, val, m.exptime(), unique); err == errCacheMiss {
+		// expired or evicted since gets
+		err = ErrNotFound
+	}
+	return err
+}
+
+// Destroy destroy the session
+func (m *MemcacheStore) Destroy(session Sessions) (err error) {
+	if readOnly(session) {
+		return ErrReadOnly
+	}
+	sid := session.GetSID()
+	if sid != "" {
+		key := m.key(sid)
+		err = m.do(key, func(c *memcacheConn) error {
+			return c.delete(key)
+		})
+		if err != nil && err != errCacheMiss {
+			return
+		}
+		err = nil
+	}
+	session.GetCookie().Remove(session.GetName(), m.opts)
+	return
+}
+
+// Close closes all idle connections of the pools
+func (m *MemcacheStore) Close() {
+	for _, pool := range m.pools {
+	loop:
+		for {
+			select {
+			case conn := <-pool:
+				conn.Close()
+			default:
+				break loop
+			}
+		}
+	}
+}
+
+// key maps sid to a memcached-safe key: no spaces or control characters
+// and well below the 250 bytes limit, whatever the client sent.
+func (m *MemcacheStore) key(sid string) string {
+	if m.mopts.SIDHasher != nil {
+		return m.mopts.Prefix + m.mopts.SIDHasher.Hash(sid)
+	}
+	sum := sha256.Sum256([]byte(sid))
+	return m.mopts.Prefix + hex.EncodeToString(sum[:])
+}
+
+// exptime follows the memcached convention: values over 30 days are
+// taken as an absolute unix time.
+func (m *MemcacheStore) exptime() int64 {
+	exptime := int64(m.opts.MaxAge)
+	if exptime > 30*24*60*60 {
+		exptime += time.Now().Unix()
+	}
+	return exptime
+}
+
+// do runs fn on a pooled connection to the server owning key. Connections
+// are only returned to the pool after a clean reply, so that a stream left
+// in an unknown state is never reused.
+func (m *MemcacheStore) do(key string, fn func(c *memcacheConn) error) (err error) {
+	server := m.ring.get(key)
+	pool := m.pools[server]
+	var conn *memcacheConn
+	select {
+	case conn = <-pool:
+	default:
+		if conn, err = dialMemcache(server, m.mopts.Timeout); err != nil {
+			return
+		}
+	}
+	err = fn(conn)
+	if err != nil && err != errCacheMiss && err != ErrConflict && err != ErrNotFound {
+		conn.Close()
+		return
+	}
+	select {
+	case pool <- conn:
+	default:
+		conn.Close()
+	}
+	return
+}
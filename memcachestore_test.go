@@ -0,0 +1,289 @@
+package sessions_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeMemcache is a minimal in-process memcached text protocol server.
+type fakeMemcache struct {
+	ln      net.Listener
+	lock    sync.Mutex
+	data    map[string]string
+	exptime map[string]string
+	unique  map[string]uint64
+	next    uint64
+	touched int
+	// onCas runs once before the next cas command is handled.
+	onCas func()
+}
+
+func newFakeMemcache(t *testing.T) *fakeMemcache {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeMemcache{ln: ln, data: make(map[string]string), exptime: make(map[string]string),
+		unique: make(map[string]uint64)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeMemcache) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeMemcache) Close() {
+	s.ln.Close()
+}
+
+func (s *fakeMemcache) Len() int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return len(s.data)
+}
+
+// store sets key like a set command from another client would.
+func (s *fakeMemcache) store(key, val, exptime string) {
+	s.next++
+	s.data[key], s.exptime[key], s.unique[key] = val, exptime, s.next
+}
+
+func (s *fakeMemcache) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		args := strings.Fields(line)
+		if len(args) < 2 {
+			io.WriteString(conn, "ERROR\r\n")
+			continue
+		}
+		if args[0] == "cas" {
+			s.lock.Lock()
+			onCas := s.onCas
+			s.onCas = nil
+			s.lock.Unlock()
+			if onCas != nil {
+				onCas()
+			}
+		}
+		s.lock.Lock()
+		switch args[0] {
+		case "get":
+			if val, ok := s.data[args[1]]; ok {
+				fmt.Fprintf(conn, "VALUE %s 0 %d\r\n%s\r\n", args[1], len(val), val)
+			}
+			io.WriteString(conn, "END\r\n")
+		case "gets":
+			if val, ok := s.data[args[1]]; ok {
+				fmt.Fprintf(conn, "VALUE %s 0 %d %d\r\n%s\r\n", args[1], len(val), s.unique[args[1]], val)
+			}
+			io.WriteString(conn, "END\r\n")
+		case "set", "add", "cas":
+			n, _ := strconv.Atoi(args[4])
+			buf := make([]byte, n+2)
+			io.ReadFull(r, buf)
+			_, ok := s.data[args[1]]
+			switch {
+			case args[0] == "add" && ok:
+				io.WriteString(conn, "NOT_STORED\r\n")
+			case args[0] == "cas" && !ok:
+				io.WriteString(conn, "NOT_FOUND\r\n")
+			case args[0] == "cas" && args[5] != strconv.FormatUint(s.unique[args[1]], 10):
+				io.WriteString(conn, "EXISTS\r\n")
+			default:
+				s.store(args[1], string(buf[:n]), args[3])
+				io.WriteString(conn, "STORED\r\n")
+			}
+		case "touch":
+			if _, ok := s.data[args[1]]; ok {
+				s.exptime[args[1]] = args[2]
+				s.touched++
+				io.WriteString(conn, "TOUCHED\r\n")
+			} else {
+				io.WriteString(conn, "NOT_FOUND\r\n")
+			}
+		case "delete":
+			if _, ok := s.data[args[1]]; ok {
+				delete(s.data, args[1])
+				io.WriteString(conn, "DELETED\r\n")
+			} else {
+				io.WriteString(conn, "NOT_FOUND\r\n")
+			}
+		default:
+			io.WriteString(conn, "ERROR\r\n")
+		}
+		s.lock.Unlock()
+	}
+}
+
+func TestMemcacheStore(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	t.Run("MemcacheStore use default options that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		server := newFakeMemcache(t)
+		defer server.Close()
+		store := sessions.NewMemcacheStore(&sessions.MemcacheOptions{
+			Servers: []string{server.Addr()},
+			Prefix:  "sess:",
+			Rolling: true,
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Age = useage
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(1, server.Len())
+		server.lock.Lock()
+		for key := range server.data {
+			assert.True(strings.HasPrefix(key, "sess:"))
+			assert.Equal(len("sess:")+64, len(key))
+		}
+		server.lock.Unlock()
+
+		//====== reuse session =====
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+
+			assert.Equal(username, session.Name)
+			assert.Equal(useage, session.Age)
+			assert.False(session.IsNew())
+			assert.Nil(session.Destroy())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(0, server.Len())
+		server.lock.Lock()
+		assert.Equal(1, server.touched)
+		server.lock.Unlock()
+
+		//====== destroyed session =====
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal("", session.Name)
+			assert.Nil(session.Destroy())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("MemcacheStore with parallel Save that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		server := newFakeMemcache(t)
+		defer server.Close()
+		store := sessions.NewMemcacheStore(&sessions.MemcacheOptions{
+			Servers: []string{server.Addr()},
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		load := func() *Session {
+			req, _ := http.NewRequest("GET", "/", nil)
+			migrateCookies(recorder, req)
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(httptest.NewRecorder(), req, SessionKeys...))
+			return session
+		}
+
+		first, second := load(), load()
+		first.Name = "first"
+		assert.Nil(first.Save())
+		second.Age = useage
+		assert.Equal(sessions.ErrConflict, second.Save())
+		assert.Equal("first", load().Name)
+
+		//====== a parallel write between gets and cas =====
+		session := load()
+		server.lock.Lock()
+		server.onCas = func() {
+			server.lock.Lock()
+			defer server.lock.Unlock()
+			for key, val := range server.data {
+				server.store(key, val, server.exptime[key])
+			}
+		}
+		server.lock.Unlock()
+		session.Name = username
+		assert.Equal(sessions.ErrConflict, session.Save())
+		assert.Equal("first", load().Name)
+
+		//====== Save after Destroy =====
+		first, second = load(), load()
+		assert.Nil(first.Destroy())
+		second.Name = "second"
+		assert.Equal(sessions.ErrNotFound, second.Save())
+		assert.Equal(0, server.Len())
+	})
+
+	t.Run("MemcacheStore with several servers that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		first := newFakeMemcache(t)
+		defer first.Close()
+		second := newFakeMemcache(t)
+		defer second.Close()
+		store := sessions.NewMemcacheStore(&sessions.MemcacheOptions{
+			Servers: []string{first.Addr(), second.Addr()},
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 100; i++ {
+				session := &Session{Meta: &sessions.Meta{}}
+				store.Load(genID(), session, cookie.New(w, r, SessionKeys...))
+				session.Name = username
+				assert.Nil(session.Save())
+			}
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(100, first.Len()+second.Len())
+		assert.True(first.Len() > 0)
+		assert.True(second.Len() > 0)
+	})
+}
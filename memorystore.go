@@ -1,37 +1,107 @@
 package sessions
 
 import (
+	"container/heap"
+	"container/list"
+	"context"
 	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
 	"io"
+	"net/http"
+	"os"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-http-utils/cookie"
 )
 
+// MemoryOptions stores the configuration of a MemoryStore.
+type MemoryOptions struct {
+	// MaxEntries is the maximum number of sessions kept, 0 means no limit.
+	MaxEntries int
+	// MaxBytes is the maximum total length of the encoded sessions kept,
+	// 0 means no limit.
+	MaxBytes int
+	// Shards is the number of independently locked partitions sessions are
+	// spread over by sid hash, defaults to 32.
+	Shards int
+	// CleanInterval is how often expired sessions are removed, defaults to
+	// 1 second. Load never returns an expired session in between.
+	CleanInterval time.Duration
+	// Clock is the source of time for expiry, defaults to the system clock.
+	Clock Clock
+	// SnapshotPath, when set, is restored from by the constructor and
+	// written to by Close, so that sessions survive restarts. A missing
+	// snapshot is ignored. One that fails to restore, see RestoreErr, is
+	// not overwritten by Close.
+	SnapshotPath string
+	// SnapshotKey, when set, encrypts snapshots with AES-GCM. It must be
+	// 16, 24 or 32 bytes long.
+	SnapshotKey []byte
+	// IDGenerator creates and validates sids, defaults to DefaultIDGenerator.
+	IDGenerator IDGenerator
+	// SignSID signs the sid cookie with the keys given to cookie.New, as
+	// CookieStore does with its values.
+	SignSID bool
+	// Keyring, when set, signs the sids themselves, see SignedIDGenerator.
+	Keyring *Keyring
+	// SIDHasher, when set, keys sessions by a keyed hash of their sid, so
+	// that snapshots hold no usable sid.
+	SIDHasher *SIDHasher
+}
+
 // NewMemoryStore returns an MemoryStore instance
 func NewMemoryStore(options ...*Options) (store *MemoryStore) {
-	opts := &cookie.Options{
-		Path:     "/",
-		HTTPOnly: true,
-		Signed:   false, // not necessary
-		MaxAge:   24 * 60 * 60,
-	}
-	if len(options) > 0 && options[0] != nil {
-		temp := options[0]
-		opts.Path = temp.Path
-		opts.Domain = temp.Domain
-		opts.MaxAge = temp.MaxAge
-		opts.Secure = temp.Secure
-		opts.HTTPOnly = temp.HTTPOnly
+	return NewMemoryStoreWithOptions(nil, options...)
+}
+
+// NewMemoryStoreWithOptions returns an MemoryStore instance configured by
+// memoryOptions. When a limit is exceeded the least recently used sessions
+// are evicted, anonymous ones before those implementing Authenticator.
+func NewMemoryStoreWithOptions(memoryOptions *MemoryOptions, options ...*Options) (store *MemoryStore) {
+	mopts := MemoryOptions{}
+	if memoryOptions != nil {
+		mopts = *memoryOptions
+	}
+	if mopts.Shards <= 0 {
+		mopts.Shards = 32
+	}
+	if mopts.CleanInterval <= 0 {
+		mopts.CleanInterval = time.Second
+	}
+	if mopts.Clock == nil {
+		mopts.Clock = realClock{}
+	}
+	if mopts.IDGenerator == nil {
+		mopts.IDGenerator = DefaultIDGenerator
+	}
+	if mopts.Keyring != nil {
+		mopts.IDGenerator = &SignedIDGenerator{Keyring: mopts.Keyring, Generator: mopts.IDGenerator}
 	}
 	store = &MemoryStore{
-		opts:   opts,
-		ticker: time.NewTicker(time.Second),
-		store:  make(map[string]*sessionValue),
-		done:   make(chan bool, 1),
+		mopts:   mopts,
+		opts:    newCookieOptions(mopts.SignSID, options),
+		clock:   mopts.Clock,
+		ticker:  mopts.Clock.NewTicker(mopts.CleanInterval),
+		shards:  make([]*memoryShard, mopts.Shards),
+		done:    make(chan bool, 1),
+		stopped: make(chan struct{}),
+		owners:  ownerIndex{subjects: make(map[string]map[string]struct{})},
+	}
+	for i := range store.shards {
+		store.shards[i] = &memoryShard{
+			store:   make(map[string]*sessionValue),
+			revoked: make(map[string]revocation),
+			anon:    list.New(),
+			authed:  list.New(),
+		}
+	}
+	if mopts.SnapshotPath != "" {
+		if err := store.restoreFile(mopts.SnapshotPath); err != nil && !os.IsNotExist(err) {
+			store.restoreErr = err
+		}
 	}
 
 	go store.cleanCache()
@@ -39,32 +109,105 @@ func NewMemoryStore(options ...*Options) (store *MemoryStore) {
 }
 
 type sessionValue struct {
-	expired time.Time
-	session string
+	// unix nanoseconds of the last Load or Save, accessed atomically
+	accessed int64
+	created  time.Time
+	expired  time.Time
+	session  string
+	sid      string
+	authed   bool
+	subject  string
+	elem     *list.Element
+	index    int
 }
 
 // MemoryStore using memory to store sessions base on secure cookies.
 type MemoryStore struct {
-	opts   *cookie.Options
-	store  map[string]*sessionValue
-	ticker *time.Ticker
-	lock   sync.Mutex
-	done   chan bool
+	// accessed atomically, kept first for 64-bit alignment
+	count     int64
+	bytes     int64
+	evictions int64
+	rejected  int64
+	closed    int32
+
+	mopts   MemoryOptions
+	opts    *cookie.Options
+	shards  []*memoryShard
+	owners  ownerIndex
+	clock   Clock
+	ticker  Ticker
+	done    chan bool
+	stopped chan struct{}
+
+	// cookieLock serializes the cookie writes of Save and Destroy, as the
+	// single store lock did before sharding, for handlers sharing one
+	// ResponseWriter across goroutines
+	cookieLock sync.Mutex
+
+	closeOnce    sync.Once
+	snapshotOnce sync.Once
+	snapshotErr  error
+	restoreErr   error
+}
+
+// memoryShard is a partition of a MemoryStore with its own lock.
+type memoryShard struct {
+	lock  sync.RWMutex
+	store map[string]*sessionValue
+	// revoked remembers why sessions were revoked until they would expire
+	revoked map[string]revocation
+	// anon and authed order the sessions from most to least recently used
+	anon   *list.List
+	authed *list.List
+	expiry expiryHeap
 }
 
 // Load a session by name and any kind of stores
 func (m *MemoryStore) Load(name string, session Sessions, cookie *cookie.Cookies) error {
-	sid, err := cookie.Get(name, m.opts.Signed)
+	if m.isClosed() {
+		session.Init(name, "", cookie, m, "")
+		return ErrStoreClosed
+	}
+	sid, err := readSID(cookie, name, m.opts, m.mopts.IDGenerator)
+	if err == ErrInvalidSID || (m.opts.Signed && err != nil && err != http.ErrNoCookie) {
+		atomic.AddInt64(&m.rejected, 1)
+	}
 	var result string
 	if sid != "" {
-		m.lock.Lock()
-		if val, ok := m.store[sid]; ok {
-			result = val.session
+		key := storageKey(m.mopts.SIDHasher, sid)
+		s := m.shard(key)
+		now := m.clock.Now()
+		var revoked *revocation
+		// read-only loads leave the LRU order alone and only take a read lock
+		if m.bounded() && !readOnly(session) {
+			// the LRU order changes, a read lock is not enough
+			s.lock.Lock()
+			if val, ok := s.store[key]; ok && val.expired.After(now) {
+				result = val.session
+				atomic.StoreInt64(&val.accessed, now.UnixNano())
+				s.list(val).MoveToFront(val.elem)
+			} else {
+				revoked = s.revocation(key, now)
+			}
+			s.lock.Unlock()
+		} else {
+			s.lock.RLock()
+			if val, ok := s.store[key]; ok && val.expired.After(now) {
+				result = val.session
+				atomic.StoreInt64(&val.accessed, now.UnixNano())
+			} else {
+				revoked = s.revocation(key, now)
+			}
+			s.lock.RUnlock()
+		}
+		if revoked != nil {
+			sid, err = "", &RevokedError{Reason: revoked.reason}
 		}
-		m.lock.Unlock()
 	}
 	if result != "" {
-		err = Decode(result, &session)
+		if result, err = decodeLoaded(result, session); result == "" {
+			sid = ""
+		}
 	}
 	session.Init(name, sid, cookie, m, result)
 	return err
@@ -72,93 +215,384 @@ func (m *MemoryStore) Load(name string, session Sessions, cookie *cookie.Cookies
 
 // Save session to Response's cookie
 func (m *MemoryStore) Save(session Sessions) (err error) {
-	val, err := Encode(session)
-	if err != nil || !session.IsChanged(val) {
+	if m.isClosed() {
+		return ErrStoreClosed
+	}
+	val, changed, err := encodeChanged(session)
+	if err != nil || !changed {
 		return
 	}
-	sid := session.GetSID()
-	if sid == "" {
-		sid = NewSID(val)
+	sid, loaded := session.GetSID(), session.GetSID() != ""
+	if !loaded {
+		if sid, err = m.mopts.IDGenerator.NewID(); err != nil {
+			return
+		}
+	}
+	authed, subject := false, ""
+	if a, ok := session.(Authenticator); ok {
+		authed = a.IsAuthenticated()
 	}
-	m.lock.Lock()
-	defer m.lock.Unlock()
-	m.store[sid] = &sessionValue{
-		session: val,
-		expired: time.Now().Add(time.Duration(m.opts.MaxAge) * time.Second),
+	if s, ok := session.(Subjecter); ok {
+		subject = s.SubjectID()
 	}
+	err = m.put(&sessionValue{
+		session: bind(session, val),
+		expired: m.clock.Now().Add(time.Duration(m.opts.MaxAge) * time.Second),
+		sid:     storageKey(m.mopts.SIDHasher, sid),
+		authed:  authed,
+		subject: subject,
+	}, session)
+	if err != nil {
+		return
+	}
+	if loaded {
+		// a second Save in the same request compares against this value
+		session.Init(session.GetName(), sid, session.GetCookie(), session.GetStore(), val)
+	}
+	m.cookieLock.Lock()
 	session.GetCookie().Set(session.GetName(), sid, m.opts)
+	m.cookieLock.Unlock()
 	return
 }
 
+// updateRetries is how many times Update retries after a conflict.
+const updateRetries = 3
+
+// Update applies fn to the session of sid and saves it, retrying the
+// load-modify-save cycle when a parallel Save wins the race, up to
+// updateRetries times before returning ErrConflict. newSession returns an
+// empty session to decode into, it is called once per attempt. The expiry
+// is kept and no cookie is set, so Update also works outside of requests.
+func (m *MemoryStore) Update(sid string, newSession func() Sessions, fn func(Sessions) error) error {
+	return m.update(storageKey(m.mopts.SIDHasher, sid), sid, newSession, fn)
+}
+
+// UpdateID is Update for the session of id, as found in SessionInfo.
+func (m *MemoryStore) UpdateID(id string, newSession func() Sessions, fn func(Sessions) error) error {
+	return m.update(id, "", newSession, fn)
+}
+
+func (m *MemoryStore) update(key, sid string, newSession func() Sessions, fn func(Sessions) error) (err error) {
+	for attempt := 0; ; attempt++ {
+		if m.isClosed() {
+			return ErrStoreClosed
+		}
+		s := m.shard(key)
+		s.lock.RLock()
+		val, ok := s.store[key]
+		var current sessionValue
+		if ok {
+			// accessed is written concurrently by Load, and not needed
+			current = sessionValue{
+				session: val.session,
+				expired: val.expired,
+				authed:  val.authed,
+				subject: val.subject,
+			}
+		}
+		s.lock.RUnlock()
+		if !ok || !current.expired.After(m.clock.Now()) {
+			return ErrNotFound
+		}
+
+		session := newSession()
+		// the fingerprint is kept as is, there is no client to check
+		stored, _ := unbind(current.session, session)
+		if err = Decode(stored, &session); err != nil {
+			return
+		}
+		session.Init("", sid, nil, m, stored)
+		if err = fn(session); err != nil {
+			return
+		}
+		value, changed, e := encodeChanged(session)
+		if e != nil || !changed {
+			return e
+		}
+		if a, ok := session.(Authenticator); ok {
+			current.authed = a.IsAuthenticated()
+		}
+		if s, ok := session.(Subjecter); ok {
+			current.subject = s.SubjectID()
+		}
+		err = m.put(&sessionValue{
+			session: bind(session, value),
+			expired: current.expired,
+			sid:     key,
+			authed:  current.authed,
+			subject: current.subject,
+		}, session)
+		if err != ErrConflict || attempt == updateRetries {
+			return err
+		}
+	}
+}
+
 // Destroy destroy the session
 func (m *MemoryStore) Destroy(session Sessions) (err error) {
+	if readOnly(session) {
+		return ErrReadOnly
+	}
+	if m.isClosed() {
+		return ErrStoreClosed
+	}
 	sid := session.GetSID()
 	if sid != "" {
-		m.lock.Lock()
-		defer m.lock.Unlock()
-		delete(m.store, sid)
+		key := storageKey(m.mopts.SIDHasher, sid)
+		s := m.shard(key)
+		s.lock.Lock()
+		if val, ok := s.store[key]; ok {
+			m.remove(s, val)
+		}
+		s.lock.Unlock()
 	}
+	m.cookieLock.Lock()
 	session.GetCookie().Remove(session.GetName(), m.opts)
+	m.cookieLock.Unlock()
 	return
 }
 
 // Len ...
 func (m *MemoryStore) Len() int {
-	m.lock.Lock()
-	defer m.lock.Unlock()
-	return len(m.store)
+	return int(atomic.LoadInt64(&m.count))
 }
 
-// Close goroutine cleanCache thread
+// Bytes returns the total length of the encoded sessions kept
+func (m *MemoryStore) Bytes() int {
+	return int(atomic.LoadInt64(&m.bytes))
+}
+
+// Evictions returns the number of sessions evicted to stay within the limits
+func (m *MemoryStore) Evictions() int64 {
+	return atomic.LoadInt64(&m.evictions)
+}
+
+// Rejected returns the number of sids refused by signature or IDGenerator
+// checks, a sign of forged or guessed ids.
+func (m *MemoryStore) Rejected() int64 {
+	return atomic.LoadInt64(&m.rejected)
+}
+
+// Close is Shutdown without a deadline. Use Shutdown for the error of
+// writing the snapshot.
 func (m *MemoryStore) Close() {
-	close(m.done)
+	m.Shutdown(context.Background())
+}
+
+// Shutdown stops the goroutine cleanCache thread and waits for it to exit,
+// then writes a snapshot if SnapshotPath is set. Load, Save and Destroy
+// return ErrStoreClosed from the first call on. It is safe to call more
+// than once, and returns ctx.Err() if ctx is done before the sweeper exits.
+func (m *MemoryStore) Shutdown(ctx context.Context) error {
+	m.closeOnce.Do(func() {
+		atomic.StoreInt32(&m.closed, 1)
+		close(m.done)
+	})
+	select {
+	case <-m.stopped:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if m.mopts.SnapshotPath != "" {
+		m.snapshotOnce.Do(func() {
+			if m.restoreErr != nil {
+				// keep the snapshot that could not be restored for inspection
+				m.snapshotErr = m.restoreErr
+				return
+			}
+			m.snapshotErr = m.snapshotFile(m.mopts.SnapshotPath)
+		})
+	}
+	return m.snapshotErr
+}
+
+func (m *MemoryStore) isClosed() bool {
+	return atomic.LoadInt32(&m.closed) == 1
 }
 
 func (m *MemoryStore) cleanCache() {
+	defer close(m.stopped)
 	defer m.ticker.Stop()
 	for {
 		select {
-		case <-m.ticker.C:
-			m.clean()
+		case now := <-m.ticker.C():
+			// one shard at a time, the others stay available meanwhile
+			for _, s := range m.shards {
+				m.clean(s, now)
+			}
 		case <-m.done:
 			return
 		}
 	}
 }
 
-func (m *MemoryStore) clean() {
-	m.lock.Lock()
-	defer m.lock.Unlock()
-	start := time.Now()
-	expireTime := start.Add(time.Millisecond * 100)
-	frequency := 24
-	var expired int
-	for {
-	label:
-		for i := 0; i < frequency; i++ {
-			for key, value := range m.store {
-				if value.expired.Before(start) {
-					delete(m.store, key)
-					expired++
-				}
-				break
-			}
+// clean removes every session of s expired by now, soonest first.
+func (m *MemoryStore) clean(s *memoryShard, now time.Time) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for len(s.expiry) > 0 && !s.expiry[0].expired.After(now) {
+		m.remove(s, s.expiry[0])
+	}
+	for key, r := range s.revoked {
+		if !r.expired.After(now) {
+			delete(s.revoked, key)
 		}
-		if expireTime.Before(time.Now()) {
-			return
+	}
+}
+
+// shard returns the partition owning sid, picked by FNV-1a hash.
+func (m *MemoryStore) shard(sid string) *memoryShard {
+	h := uint32(2166136261)
+	for i := 0; i < len(sid); i++ {
+		h ^= uint32(sid[i])
+		h *= 16777619
+	}
+	return m.shards[h%uint32(len(m.shards))]
+}
+
+// put stores value, replacing any session with the same sid, and evicts
+// others if a limit is exceeded. Unless expect is nil, the stored session
+// is checked to be the one expect was loaded from, see checkStored.
+func (m *MemoryStore) put(value *sessionValue, expect Sessions) error {
+	s := m.shard(value.sid)
+	s.lock.Lock()
+	now := m.clock.Now()
+	old, ok := s.store[value.sid]
+	if expect != nil {
+		current := ""
+		if ok && old.expired.After(now) {
+			current = old.session
+		}
+		if err := checkStored(expect, current); err != nil {
+			s.lock.Unlock()
+			return err
 		}
-		if expired > frequency/4 {
-			expired = 0
-			goto label
+	}
+	if ok {
+		if value.created.IsZero() {
+			value.created = old.created
 		}
+		m.remove(s, old)
+	}
+	if value.created.IsZero() {
+		value.created = now
+	}
+	value.accessed = now.UnixNano()
+	value.elem = s.list(value).PushFront(value)
+	heap.Push(&s.expiry, value)
+	s.store[value.sid] = value
+	m.owners.add(value)
+	atomic.AddInt64(&m.count, 1)
+	atomic.AddInt64(&m.bytes, int64(len(value.session)))
+	s.lock.Unlock()
+
+	m.evict(s, value)
+	return nil
+}
+
+// remove drops value from the shard, its LRU list and the counters.
+// s.lock must be held.
+func (m *MemoryStore) remove(s *memoryShard, value *sessionValue) {
+	delete(s.store, value.sid)
+	s.list(value).Remove(value.elem)
+	heap.Remove(&s.expiry, value.index)
+	m.owners.remove(value)
+	atomic.AddInt64(&m.count, -1)
+	atomic.AddInt64(&m.bytes, -int64(len(value.session)))
+}
+
+// evict drops least recently used sessions until the store is within its
+// limits again. Anonymous sessions go first, and within each kind the shard
+// that just grew is tried before the others. keep is never evicted.
+func (m *MemoryStore) evict(from *memoryShard, keep *sessionValue) {
+	if !m.bounded() {
 		return
 	}
+	for _, authed := range []bool{false, true} {
+		if m.evictFrom(from, keep, authed) {
+			return
+		}
+		for _, s := range m.shards {
+			if s != from && m.evictFrom(s, keep, authed) {
+				return
+			}
+		}
+	}
+}
+
+// evictFrom evicts from one list of s and reports whether the store is
+// within its limits afterwards.
+func (m *MemoryStore) evictFrom(s *memoryShard, keep *sessionValue, authed bool) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	l := s.anon
+	if authed {
+		l = s.authed
+	}
+	for e := l.Back(); e != nil && m.overLimit(); {
+		prev := e.Prev()
+		if value := e.Value.(*sessionValue); value != keep {
+			m.remove(s, value)
+			atomic.AddInt64(&m.evictions, 1)
+		}
+		e = prev
+	}
+	return !m.overLimit()
+}
+
+func (m *MemoryStore) bounded() bool {
+	return m.mopts.MaxEntries > 0 || m.mopts.MaxBytes > 0
+}
+
+func (m *MemoryStore) overLimit() bool {
+	return (m.mopts.MaxEntries > 0 && atomic.LoadInt64(&m.count) > int64(m.mopts.MaxEntries)) ||
+		(m.mopts.MaxBytes > 0 && atomic.LoadInt64(&m.bytes) > int64(m.mopts.MaxBytes))
+}
+
+func (s *memoryShard) list(v *sessionValue) *list.List {
+	if v.authed {
+		return s.authed
+	}
+	return s.anon
+}
+
+// expiryHeap orders sessions by expiry time, soonest first.
+type expiryHeap []*sessionValue
+
+func (h expiryHeap) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap) Less(i, j int) bool {
+	return h[i].expired.Before(h[j].expired)
+}
+
+func (h expiryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap) Push(x interface{}) {
+	value := x.(*sessionValue)
+	value.index = len(*h)
+	*h = append(*h, value)
+}
+
+func (h *expiryHeap) Pop() interface{} {
+	old := *h
+	value := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	return value
 }
 
-// NewSID generates a random SID
+// NewSID generates a random SID of 64 hex chars.
+//
+// Stores use an IDGenerator instead, see DefaultIDGenerator.
 func NewSID(val string) string {
 	h := sha256.New()
 	h.Write([]byte(val))
-	io.CopyN(h, rand.Reader, 8)
+	io.CopyN(h, rand.Reader, 32)
 	return hex.EncodeToString(h.Sum(nil))
 }
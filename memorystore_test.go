@@ -1,16 +1,20 @@
 package sessions_test
 
 import (
+	"context"
 	"crypto/rand"
 	"encoding/hex"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/go-http-utils/cookie"
 	"github.com/go-http-utils/cookie-session"
+	"github.com/go-http-utils/cookie-session/sessionstest"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -193,7 +197,10 @@ func TestMemoryStore(t *testing.T) {
 		assert.Nil(err)
 		recorder := httptest.NewRecorder()
 
-		store := sessions.NewMemoryStore(&sessions.Options{
+		clock := sessionstest.NewFakeClock(time.Now())
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{
+			Clock: clock,
+		}, &sessions.Options{
 			Path:     "xxx.com",
 			HTTPOnly: true,
 			MaxAge:   2,
@@ -225,8 +232,8 @@ func TestMemoryStore(t *testing.T) {
 			wg.Wait()
 		})
 		handler.ServeHTTP(recorder, req)
-		time.Sleep(time.Second * 3)
-		assert.Equal(0, store.Len())
+		clock.Advance(time.Second * 3)
+		assert.True(eventually(func() bool { return store.Len() == 0 }))
 		//====== reuse session =====
 		req, err = http.NewRequest("GET", "/", nil)
 		migrateCookies(recorder, req)
@@ -244,6 +251,309 @@ func TestMemoryStore(t *testing.T) {
 	})
 }
 
+func TestBoundedMemoryStore(t *testing.T) {
+	SessionKeys := []string{"keyxxx"}
+
+	t.Run("MemoryStore with MaxEntries that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{MaxEntries: 3})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load("authed", session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Authed = 1
+			session.Save()
+
+			for i := 0; i < 5; i++ {
+				sess := &Session{Meta: &sessions.Meta{}}
+				store.Load(genID(), sess, cookie.New(w, r, SessionKeys...))
+				sess.Name = username
+				sess.Age = int64(i)
+				sess.Save()
+			}
+		})
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(3, store.Len())
+		assert.Equal(int64(3), store.Evictions())
+
+		//====== authenticated session survives =====
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load("authed", session, cookie.New(w, r, SessionKeys...))
+			assert.Equal(username, session.Name)
+			assert.Equal(int64(1), session.Authed)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("MemoryStore with MaxBytes that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{MaxBytes: 200})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for i := 0; i < 10; i++ {
+				sess := &Session{Meta: &sessions.Meta{}}
+				store.Load(genID(), sess, cookie.New(w, r, SessionKeys...))
+				sess.Name = username
+				sess.Save()
+			}
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.True(store.Bytes() <= 200)
+		assert.True(store.Len() < 10)
+		assert.Equal(int64(10-store.Len()), store.Evictions())
+	})
+}
+
+func TestMemoryStoreExpiry(t *testing.T) {
+	assert := assert.New(t)
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	clock := sessionstest.NewFakeClock(time.Now())
+	store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{
+		CleanInterval: time.Hour,
+		Clock:         clock,
+	}, &sessions.Options{
+		Path:     "/",
+		HTTPOnly: true,
+		MaxAge:   1,
+	})
+	defer store.Close()
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := &Session{Meta: &sessions.Meta{}}
+		store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+		session.Name = username
+		session.Save()
+	})
+	handler.ServeHTTP(recorder, req)
+	clock.Advance(time.Second * 2)
+
+	//====== expired session is refused before the sweep =====
+	req, _ = http.NewRequest("GET", "/", nil)
+	migrateCookies(recorder, req)
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := &Session{Meta: &sessions.Meta{}}
+		store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+		assert.Equal("", session.Name)
+		assert.False(session.IsChanged(""))
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(1, store.Len())
+
+	//====== and removed by it =====
+	clock.Advance(time.Hour)
+	assert.True(eventually(func() bool { return store.Len() == 0 }))
+}
+
+func TestMemoryStoreClose(t *testing.T) {
+	assert := assert.New(t)
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	store := sessions.NewMemoryStore()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Nil(store.Shutdown(ctx))
+	// idempotent
+	assert.NotPanics(store.Close)
+	assert.Nil(store.Shutdown(ctx))
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := &Session{Meta: &sessions.Meta{}}
+		assert.Equal(sessions.ErrStoreClosed, store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+		assert.Equal(store, session.GetStore())
+		session.Name = username
+		assert.Equal(sessions.ErrStoreClosed, session.Save())
+		assert.Equal(sessions.ErrStoreClosed, session.Destroy())
+	})
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+	assert.Equal(0, store.Len())
+}
+
+func TestMemoryStoreConflict(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	clock := sessionstest.NewFakeClock(time.Now())
+	store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{Clock: clock})
+	defer store.Close()
+
+	var recorder *httptest.ResponseRecorder
+	create := func() *http.Cookie {
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder = httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Save()
+		})
+		handler.ServeHTTP(recorder, req)
+		sid, _ := getCookie(SessionName, recorder)
+		return sid
+	}
+	sid := create()
+
+	load := func() *Session {
+		req, _ := http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		session := &Session{Meta: &sessions.Meta{}}
+		store.Load(SessionName, session, cookie.New(httptest.NewRecorder(), req, SessionKeys...))
+		return session
+	}
+	newSession := func() sessions.Sessions {
+		return &Session{Meta: &sessions.Meta{}}
+	}
+
+	t.Run("parallel Save that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		first, second := load(), load()
+		first.Name = "first"
+		assert.Nil(first.Save())
+		second.Age = useage
+		assert.Equal(sessions.ErrConflict, second.Save())
+
+		session := load()
+		assert.Equal("first", session.Name)
+		assert.Equal(int64(0), session.Age)
+
+		//====== saved twice in one request =====
+		session.Name = username
+		assert.Nil(session.Save())
+		session.Age = useage
+		assert.Nil(session.Save())
+		assert.Equal(useage, load().Age)
+	})
+
+	t.Run("Update that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		calls := 0
+		err := store.Update(sid.Value, newSession, func(s sessions.Sessions) error {
+			calls++
+			if calls == 1 {
+				// a parallel writer wins the first attempt
+				assert.Nil(store.Update(sid.Value, newSession, func(s sessions.Sessions) error {
+					s.(*Session).Authed++
+					return nil
+				}))
+			}
+			s.(*Session).Authed++
+			return nil
+		})
+		assert.Nil(err)
+		assert.Equal(2, calls)
+		assert.Equal(int64(2), load().Authed)
+
+		assert.Equal(sessions.ErrNotFound, store.Update(genID(), newSession, func(s sessions.Sessions) error {
+			return nil
+		}))
+	})
+
+	t.Run("Update with parallel Load that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		age := load().Age
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 50; j++ {
+					load()
+				}
+			}()
+		}
+		for i := 0; i < 50; i++ {
+			assert.Nil(store.Update(sid.Value, newSession, func(s sessions.Sessions) error {
+				s.(*Session).Age++
+				return nil
+			}))
+		}
+		wg.Wait()
+		assert.Equal(age+50, load().Age)
+	})
+
+	t.Run("Save after Destroy that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		first, second := load(), load()
+		assert.Nil(first.Destroy())
+		second.Name = "second"
+		assert.Equal(sessions.ErrNotFound, second.Save())
+		assert.Equal(0, store.Len())
+	})
+
+	t.Run("Save after expiry that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		create()
+		session := load()
+		assert.Equal(username, session.Name)
+		clock.Advance(25 * time.Hour)
+		session.Name = "late"
+		assert.Equal(sessions.ErrNotFound, session.Save())
+	})
+}
+
+func BenchmarkMemoryStore(b *testing.B) {
+	for _, shards := range []int{1, 32} {
+		b.Run(fmt.Sprintf("shards=%d", shards), func(b *testing.B) {
+			store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{Shards: shards})
+			defer store.Close()
+
+			// a pool of existing sessions, read 9 times for every write
+			var reqs []*http.Request
+			handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				session := &Session{Meta: &sessions.Meta{}}
+				store.Load("bench", session, cookie.New(w, r))
+				session.Name = genID()
+				session.Save()
+			})
+			for i := 0; i < 1024; i++ {
+				recorder := httptest.NewRecorder()
+				handler.ServeHTTP(recorder, httptest.NewRequest("GET", "/", nil))
+				req := httptest.NewRequest("GET", "/", nil)
+				migrateCookies(recorder, req)
+				reqs = append(reqs, req)
+			}
+
+			var n uint32
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				w := httptest.NewRecorder()
+				for pb.Next() {
+					i := atomic.AddUint32(&n, 1)
+					session := &Session{Meta: &sessions.Meta{}}
+					store.Load("bench", session, cookie.New(w, reqs[i%uint32(len(reqs))]))
+					if i%10 == 0 {
+						session.Age = int64(i)
+						session.Save()
+					}
+				}
+			})
+		})
+	}
+}
+
+// eventually waits for a store's sweeper goroutine to catch up with a fake clock.
+func eventually(cond func() bool) bool {
+	for i := 0; i < 1000 && !cond(); i++ {
+		time.Sleep(time.Millisecond)
+	}
+	return cond()
+}
+
 func genID() string {
 	buf := make([]byte, 12)
 	_, err := rand.Read(buf)
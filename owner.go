@@ -0,0 +1,138 @@
+package sessions
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// OwnerIndex is implemented by stores that index sessions by the subject
+// they are bound to, see Subjecter.
+type OwnerIndex interface {
+	// SessionsFor returns the live sessions bound to subject.
+	SessionsFor(subject string) ([]SessionInfo, error)
+	// DestroyAllFor destroys every session bound to subject, such as on
+	// "log out everywhere", and returns how many were destroyed.
+	DestroyAllFor(subject string) (int, error)
+	// DestroyOthers destroys the sessions bound to subject except the one
+	// of keepSID, such as after a password change.
+	DestroyOthers(subject, keepSID string) (int, error)
+}
+
+// SessionInfo describes a stored session.
+type SessionInfo struct {
+	// ID is the key the session is stored under: its sid, or the hash of
+	// it when the store has a SIDHasher.
+	ID       string    `json:"id"`
+	Subject  string    `json:"subject,omitempty"`
+	Created  time.Time `json:"created"`
+	Accessed time.Time `json:"accessed"`
+	Expired  time.Time `json:"expired"`
+	Authed   bool      `json:"authed"`
+}
+
+// ownerIndex maps subjects to the storage keys of their sessions.
+type ownerIndex struct {
+	lock     sync.Mutex
+	subjects map[string]map[string]struct{}
+}
+
+func (o *ownerIndex) add(value *sessionValue) {
+	if value.subject == "" {
+		return
+	}
+	o.lock.Lock()
+	keys, ok := o.subjects[value.subject]
+	if !ok {
+		keys = make(map[string]struct{})
+		o.subjects[value.subject] = keys
+	}
+	keys[value.sid] = struct{}{}
+	o.lock.Unlock()
+}
+
+func (o *ownerIndex) remove(value *sessionValue) {
+	if value.subject == "" {
+		return
+	}
+	o.lock.Lock()
+	if keys, ok := o.subjects[value.subject]; ok {
+		delete(keys, value.sid)
+		if len(keys) == 0 {
+			delete(o.subjects, value.subject)
+		}
+	}
+	o.lock.Unlock()
+}
+
+// keys returns a copy of the storage keys of subject, so that shards can
+// be locked without holding the index lock.
+func (o *ownerIndex) keys(subject string) []string {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	keys := make([]string, 0, len(o.subjects[subject]))
+	for key := range o.subjects[subject] {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// SessionsFor returns the live sessions bound to subject.
+func (m *MemoryStore) SessionsFor(subject string) ([]SessionInfo, error) {
+	if m.isClosed() {
+		return nil, ErrStoreClosed
+	}
+	var infos []SessionInfo
+	now := m.clock.Now()
+	for _, key := range m.owners.keys(subject) {
+		s := m.shard(key)
+		s.lock.RLock()
+		if val, ok := s.store[key]; ok && val.subject == subject && val.expired.After(now) {
+			infos = append(infos, val.info())
+		}
+		s.lock.RUnlock()
+	}
+	return infos, nil
+}
+
+// info returns the SessionInfo of v, the shard lock must be held.
+func (v *sessionValue) info() SessionInfo {
+	return SessionInfo{
+		ID:       v.sid,
+		Subject:  v.subject,
+		Created:  v.created,
+		Accessed: time.Unix(0, atomic.LoadInt64(&v.accessed)),
+		Expired:  v.expired,
+		Authed:   v.authed,
+	}
+}
+
+// DestroyAllFor destroys every session bound to subject.
+func (m *MemoryStore) DestroyAllFor(subject string) (int, error) {
+	return m.destroyFor(subject, "")
+}
+
+// DestroyOthers destroys the sessions bound to subject except the one of
+// keepSID.
+func (m *MemoryStore) DestroyOthers(subject, keepSID string) (int, error) {
+	return m.destroyFor(subject, storageKey(m.mopts.SIDHasher, keepSID))
+}
+
+func (m *MemoryStore) destroyFor(subject, keep string) (n int, err error) {
+	if m.isClosed() {
+		return 0, ErrStoreClosed
+	}
+	for _, key := range m.owners.keys(subject) {
+		if key == keep {
+			continue
+		}
+		s := m.shard(key)
+		s.lock.Lock()
+		if val, ok := s.store[key]; ok && val.subject == subject {
+			m.remove(s, val)
+			n++
+		}
+		s.lock.Unlock()
+	}
+	return
+}
@@ -0,0 +1,116 @@
+package sessions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+// UserSession is bound to the user signed in with it.
+type UserSession struct {
+	*sessions.Meta `json:"-"`
+	UserID         string `json:"uid"`
+}
+
+func (s *UserSession) Save() error {
+	return s.GetStore().Save(s)
+}
+
+func (s *UserSession) SubjectID() string {
+	return s.UserID
+}
+
+func TestOwnerIndex(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	login := func(store sessions.Store, uid string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &UserSession{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.UserID = uid
+			session.Save()
+		})
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("MemoryStore log out everywhere that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+		var index sessions.OwnerIndex = store
+
+		first := login(store, "u1")
+		second := login(store, "u1")
+		login(store, "u1")
+		login(store, "u2")
+
+		infos, err := index.SessionsFor("u1")
+		assert.Nil(err)
+		assert.Equal(3, len(infos))
+
+		sid, _ := getCookie(SessionName, first)
+		n, err := index.DestroyOthers("u1", sid.Value)
+		assert.Nil(err)
+		assert.Equal(2, n)
+		infos, _ = index.SessionsFor("u1")
+		assert.Equal(1, len(infos))
+		assert.Equal(sid.Value, infos[0].ID)
+
+		//====== destroyed session =====
+		req, _ := http.NewRequest("GET", "/", nil)
+		migrateCookies(second, req)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &UserSession{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal("", session.UserID)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		n, _ = index.DestroyAllFor("u1")
+		assert.Equal(1, n)
+		infos, _ = index.SessionsFor("u1")
+		assert.Equal(0, len(infos))
+		infos, _ = index.SessionsFor("u2")
+		assert.Equal(1, len(infos))
+		assert.Equal(1, store.Len())
+	})
+
+	t.Run("MemoryStore with SIDHasher that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		h, _ := sessions.NewSIDHasher([]byte("secret"))
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{
+			SIDHasher: h,
+		})
+		defer store.Close()
+
+		sid, _ := getCookie(SessionName, login(store, "u1"))
+		login(store, "u1")
+
+		n, err := store.DestroyOthers("u1", sid.Value)
+		assert.Nil(err)
+		assert.Equal(1, n)
+		infos, _ := store.SessionsFor("u1")
+		assert.Equal(1, len(infos))
+		assert.NotEqual(sid.Value, infos[0].ID)
+	})
+
+	t.Run("MemoryStore closed that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		store.Close()
+
+		_, err := store.SessionsFor("u1")
+		assert.Equal(sessions.ErrStoreClosed, err)
+		_, err = store.DestroyAllFor("u1")
+		assert.Equal(sessions.ErrStoreClosed, err)
+	})
+}
@@ -0,0 +1,29 @@
+package sessions
+
+import (
+	"context"
+	"net/http"
+)
+
+type readOnlyKey struct{}
+
+// NewReadOnlyHandler returns an http.Handler marking every request to next
+// read-only, for routes that must not change sessions. Handlers pass
+// IsReadOnly(r) to Meta.ReadOnly when creating their sessions.
+func NewReadOnlyHandler(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, WithReadOnly(r))
+	})
+}
+
+// WithReadOnly returns a shallow copy of r marked read-only.
+func WithReadOnly(r *http.Request) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), readOnlyKey{}, true))
+}
+
+// IsReadOnly reports whether r was marked read-only by NewReadOnlyHandler,
+// WithReadOnly or NewLockHandler with LockOptions.MarkReadOnly.
+func IsReadOnly(r *http.Request) bool {
+	readOnly, _ := r.Context().Value(readOnlyKey{}).(bool)
+	return readOnly
+}
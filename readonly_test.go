@@ -0,0 +1,122 @@
+package sessions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReadOnly(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	save := func(store sessions.Store) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Save()
+		})
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	readOnly := func(store sessions.Store, from *httptest.ResponseRecorder, fn func(session *Session)) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		migrateCookies(from, req)
+		recorder := httptest.NewRecorder()
+		handler := sessions.NewReadOnlyHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{ReadOnly: sessions.IsReadOnly(r)}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			fn(session)
+		}))
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("CookieStore read-only that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.New()
+		recorder := readOnly(store, save(store), func(session *Session) {
+			assert.True(session.ReadOnly)
+			assert.Equal(username, session.Name)
+			assert.Nil(session.Save())
+			session.Age = useage
+			assert.Equal(sessions.ErrReadOnly, session.Save())
+			assert.Equal(sessions.ErrReadOnly, session.Destroy())
+		})
+		assert.Equal(0, len(recorder.Result().Cookies()))
+	})
+
+	t.Run("MemoryStore read-only that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{MaxEntries: 10})
+		defer store.Close()
+		from := save(store)
+		recorder := readOnly(store, from, func(session *Session) {
+			assert.Equal(username, session.Name)
+			session.Name = "changed"
+			assert.Equal(sessions.ErrReadOnly, session.Save())
+			assert.Equal(sessions.ErrReadOnly, session.Destroy())
+		})
+		assert.Equal(0, len(recorder.Result().Cookies()))
+		readOnly(store, from, func(session *Session) {
+			assert.Equal(username, session.Name)
+		})
+		assert.Equal(1, store.Len())
+	})
+
+	t.Run("RedisStore rolling read-only that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		server := newFakeRedis(t)
+		defer server.Close()
+		store := sessions.NewRedisStore(&sessions.RedisOptions{Addr: server.Addr(), Rolling: true})
+		defer store.Close()
+
+		from := save(store)
+		server.lock.Lock()
+		server.cmds = nil
+		server.lock.Unlock()
+		recorder := readOnly(store, from, func(session *Session) {
+			assert.Equal(username, session.Name)
+			assert.Nil(session.Save())
+		})
+		assert.Equal(0, len(recorder.Result().Cookies()))
+		server.lock.Lock()
+		assert.Equal([]string{"GET"}, server.cmds)
+		server.lock.Unlock()
+	})
+
+	t.Run("handlers marking requests read-only that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		var marked bool
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			marked = sessions.IsReadOnly(r)
+		})
+
+		req, _ := http.NewRequest("POST", "/", nil)
+		next.ServeHTTP(httptest.NewRecorder(), req)
+		assert.False(marked)
+		sessions.NewReadOnlyHandler(next).ServeHTTP(httptest.NewRecorder(), req)
+		assert.True(marked)
+
+		req.AddCookie(&http.Cookie{Name: SessionName, Value: "sid"})
+		req.Method = "GET"
+		// skipping the lock does not imply read-only unless asked for
+		sessions.NewLockHandler(next, SessionName, nil).ServeHTTP(httptest.NewRecorder(), req)
+		assert.False(marked)
+
+		locked := sessions.NewLockHandler(next, SessionName, &sessions.LockOptions{MarkReadOnly: true})
+		locked.ServeHTTP(httptest.NewRecorder(), req)
+		assert.True(marked)
+		req.Method = "POST"
+		locked.ServeHTTP(httptest.NewRecorder(), req)
+		assert.False(marked)
+	})
+}
@@ -0,0 +1,250 @@
+package sessions
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+)
+
+// RedisOptions stores the connection configuration of a RedisStore.
+type RedisOptions struct {
+	// Addr is the redis server address, defaults to "127.0.0.1:6379".
+	Addr string
+	// Password is sent with AUTH when not empty.
+	Password string
+	// DB is selected with SELECT when not zero.
+	DB int
+	// Prefix is prepended to every sid to build the redis key.
+	Prefix string
+	// PoolSize is the maximum number of idle connections kept, defaults to 10.
+	PoolSize int
+	// Timeout is used for dialing and for every command, defaults to 5 seconds.
+	Timeout time.Duration
+	// Rolling refreshes the expiry of a session every time it is loaded.
+	Rolling bool
+	// IDGenerator creates and validates sids, defaults to DefaultIDGenerator.
+	IDGenerator IDGenerator
+	// SIDHasher, when set, builds the redis keys from a keyed hash of each
+	// sid instead of the sid itself.
+	SIDHasher *SIDHasher
+}
+
+// NewRedisStore returns an RedisStore instance
+func NewRedisStore(redisOptions *RedisOptions, options ...*Options) (store *RedisStore) {
+	ropts := RedisOptions{}
+	if redisOptions != nil {
+		ropts = *redisOptions
+	}
+	if ropts.Addr == "" {
+		ropts.Addr = "127.0.0.1:6379"
+	}
+	if ropts.PoolSize <= 0 {
+		ropts.PoolSize = 10
+	}
+	if ropts.Timeout <= 0 {
+		ropts.Timeout = 5 * time.Second
+	}
+	if ropts.IDGenerator == nil {
+		ropts.IDGenerator = DefaultIDGenerator
+	}
+	store = &RedisStore{
+		ropts: ropts,
+		opts:  newCookieOptions(false, options), // signing not necessary
+		pool:  make(chan *redisConn, ropts.PoolSize),
+	}
+	return
+}
+
+// RedisStore using redis to store sessions base on secure cookies.
+type RedisStore struct {
+	ropts RedisOptions
+	opts  *cookie.Options
+	pool  chan *redisConn
+}
+
+// Load a session by name and any kind of stores
+func (r *RedisStore) Load(name string, session Sessions, cookie *cookie.Cookies) error {
+	sid, err := readSID(cookie, name, r.opts, r.ropts.IDGenerator)
+	var result string
+	if sid != "" {
+		var reply interface{}
+		var e error
+		if r.ropts.Rolling && !readOnly(session) {
+			reply, e = r.do("GETEX", r.key(sid), "EX", r.maxAge())
+		} else {
+			reply, e = r.do("GET", r.key(sid))
+		}
+		if e != nil {
+			err = e
+		} else if val, ok := reply.(string); ok {
+			result = val
+		}
+	}
+	if result != "" {
+		if result, err = decodeLoaded(result, session); result == "" {
+			sid = ""
+		}
+	}
+	session.Init(name, sid, cookie, r, result)
+	return err
+}
+
+// Save session to Response's cookie
+func (r *RedisStore) Save(session Sessions) (err error) {
+	val, changed, err := encodeChanged(session)
+	if err != nil {
+		return
+	}
+	if !changed {
+		if r.ropts.Rolling && !session.IsNew() && !readOnly(session) {
+			// the key was refreshed by GETEX, keep the cookie in step
+			session.GetCookie().Set(session.GetName(), session.GetSID(), r.opts)
+		}
+		return
+	}
+	sid := session.GetSID()
+	_, raw := session.(*rawSession)
+	if sid == "" {
+		if sid, err = r.ropts.IDGenerator.NewID(); err != nil {
+			return
+		}
+		raw = true
+	}
+	if raw {
+		_, err = r.do("SET", r.key(sid), bind(session, val), "EX", r.maxAge())
+	} else {
+		err = r.setChecked(session, r.key(sid), bind(session, val))
+	}
+	if err != nil {
+		return
+	}
+	session.GetCookie().Set(session.GetName(), sid, r.opts)
+	return
+}
+
+// setChecked replaces the loaded session at key in a WATCH and MULTI
+// transaction, returning ErrConflict if another Save won the race, see
+// checkStored.
+func (r *RedisStore) setChecked(session Sessions, key, val string) (err error) {
+	conn, err := r.get()
+	if err != nil {
+		return
+	}
+	defer func() {
+		if err != nil && err != ErrConflict && err != ErrNotFound {
+			// the transaction may still be open
+			conn.Close()
+			return
+		}
+		r.put(conn)
+	}()
+	if _, err = conn.do("WATCH", key); err != nil {
+		return
+	}
+	reply, err := conn.do("GET", key)
+	if err != nil {
+		return
+	}
+	stored, _ := reply.(string)
+	if err = checkStored(session, stored); err != nil {
+		if _, e := conn.do("UNWATCH"); e != nil {
+			return e
+		}
+		return
+	}
+	if _, err = conn.do("MULTI"); err != nil {
+		return
+	}
+	if _, err = conn.do("SET", key, val, "EX", r.maxAge()); err != nil {
+		return
+	}
+	if reply, err = conn.do("EXEC"); err == nil && reply == nil {
+		// the watched key changed before EXEC
+		err = ErrConflict
+	}
+	return
+}
+
+// Destroy destroy the session
+func (r *RedisStore) Destroy(session Sessions) (err error) {
+	if readOnly(session) {
+		return ErrReadOnly
+	}
+	sid := session.GetSID()
+	if sid != "" {
+		if _, err = r.do("DEL", r.key(sid)); err != nil {
+			return
+		}
+	}
+	session.GetCookie().Remove(session.GetName(), r.opts)
+	return
+}
+
+// Close closes all idle connections of the pool
+func (r *RedisStore) Close() {
+	for {
+		select {
+		case conn := <-r.pool:
+			conn.Close()
+		default:
+			return
+		}
+	}
+}
+
+func (r *RedisStore) key(sid string) string {
+	return r.ropts.Prefix + storageKey(r.ropts.SIDHasher, sid)
+}
+
+func (r *RedisStore) maxAge() string {
+	return strconv.Itoa(r.opts.MaxAge)
+}
+
+// do runs a command on a pooled connection. Connections are only returned
+// to the pool when the server answered, so a broken one is never reused.
+func (r *RedisStore) do(args ...string) (reply interface{}, err error) {
+	conn, err := r.get()
+	if err != nil {
+		return
+	}
+	reply, err = conn.do(args...)
+	if _, ok := err.(RedisError); err != nil && !ok {
+		conn.Close()
+		return
+	}
+	r.put(conn)
+	return
+}
+
+func (r *RedisStore) get() (conn *redisConn, err error) {
+	select {
+	case conn = <-r.pool:
+		return
+	default:
+	}
+	if conn, err = dialRedis(r.ropts.Addr, r.ropts.Timeout); err != nil {
+		return
+	}
+	if r.ropts.Password != "" {
+		if _, err = conn.do("AUTH", r.ropts.Password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if r.ropts.DB != 0 {
+		if _, err = conn.do("SELECT", strconv.Itoa(r.ropts.DB)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return
+}
+
+func (r *RedisStore) put(conn *redisConn) {
+	select {
+	case r.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
@@ -0,0 +1,357 @@
+package sessions_test
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeRedis is a minimal in-process RESP server for the commands RedisStore uses.
+type fakeRedis struct {
+	ln      net.Listener
+	lock    sync.Mutex
+	data    map[string]string
+	ttl     map[string]int
+	version map[string]int
+	cmds    []string
+	// onExec runs once before the next EXEC checks the watched keys.
+	onExec func()
+	// failSet makes SET reply with an error.
+	failSet bool
+}
+
+func newFakeRedis(t *testing.T) *fakeRedis {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeRedis{ln: ln, data: make(map[string]string), ttl: make(map[string]int),
+		version: make(map[string]int)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *fakeRedis) Addr() string {
+	return s.ln.Addr().String()
+}
+
+func (s *fakeRedis) Close() {
+	s.ln.Close()
+}
+
+func (s *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	// transaction state of the connection
+	watched := make(map[string]int)
+	var queued [][]string
+	multi := false
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		switch cmd := strings.ToUpper(args[0]); {
+		case cmd == "WATCH":
+			s.lock.Lock()
+			s.cmds = append(s.cmds, cmd)
+			watched[args[1]] = s.version[args[1]]
+			s.lock.Unlock()
+			io.WriteString(conn, "+OK\r\n")
+		case cmd == "UNWATCH":
+			watched = make(map[string]int)
+			io.WriteString(conn, "+OK\r\n")
+		case cmd == "MULTI":
+			multi = true
+			io.WriteString(conn, "+OK\r\n")
+		case cmd == "EXEC":
+			s.lock.Lock()
+			onExec := s.onExec
+			s.onExec = nil
+			s.lock.Unlock()
+			if onExec != nil {
+				onExec()
+			}
+			io.WriteString(conn, s.execMulti(watched, queued))
+			watched, queued, multi = make(map[string]int), nil, false
+		case multi:
+			queued = append(queued, args)
+			io.WriteString(conn, "+QUEUED\r\n")
+		default:
+			io.WriteString(conn, s.exec(args))
+		}
+	}
+}
+
+func (s *fakeRedis) execMulti(watched map[string]int, queued [][]string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.cmds = append(s.cmds, "EXEC")
+	for key, version := range watched {
+		if s.version[key] != version {
+			return "*-1\r\n"
+		}
+	}
+	reply := fmt.Sprintf("*%d\r\n", len(queued))
+	for _, args := range queued {
+		reply += s.execLocked(args)
+	}
+	return reply
+}
+
+func (s *fakeRedis) exec(args []string) string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.execLocked(args)
+}
+
+func (s *fakeRedis) execLocked(args []string) string {
+	cmd := strings.ToUpper(args[0])
+	s.cmds = append(s.cmds, cmd)
+	switch {
+	case cmd == "AUTH" || cmd == "SELECT":
+		return "+OK\r\n"
+	case cmd == "SET" && s.failSet:
+		return "-ERR failing\r\n"
+	case cmd == "SET" && len(args) == 5:
+		s.data[args[1]] = args[2]
+		s.ttl[args[1]], _ = strconv.Atoi(args[4])
+		s.version[args[1]]++
+		return "+OK\r\n"
+	case cmd == "GET" || cmd == "GETEX":
+		val, ok := s.data[args[1]]
+		if !ok {
+			return "$-1\r\n"
+		}
+		if len(args) == 4 {
+			s.ttl[args[1]], _ = strconv.Atoi(args[3])
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(val), val)
+	case cmd == "DEL":
+		_, ok := s.data[args[1]]
+		delete(s.data, args[1])
+		delete(s.ttl, args[1])
+		s.version[args[1]]++
+		if ok {
+			return ":1\r\n"
+		}
+		return ":0\r\n"
+	}
+	return "-ERR unknown command\r\n"
+}
+
+func (s *fakeRedis) get(key string) (string, int, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	val, ok := s.data[key]
+	return val, s.ttl[key], ok
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		if line, err = r.ReadString('\n'); err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(line[1:]))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err = io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func TestRedisStore(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	server := newFakeRedis(t)
+	defer server.Close()
+
+	t.Run("RedisStore use default options that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewRedisStore(&sessions.RedisOptions{
+			Addr:     server.Addr(),
+			Prefix:   "sess:",
+			Password: "secret",
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Age = useage
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		sid, _ := getCookie(SessionName, recorder)
+		_, ttl, ok := server.get("sess:" + sid.Value)
+		assert.True(ok)
+		assert.Equal(24*60*60, ttl)
+
+		//====== reuse session =====
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+
+			assert.Equal(username, session.Name)
+			assert.Equal(useage, session.Age)
+			assert.False(session.IsNew())
+			assert.Nil(session.Destroy())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		_, _, ok = server.get("sess:" + sid.Value)
+		assert.False(ok)
+	})
+
+	t.Run("RedisStore with rolling expiry that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewRedisStore(&sessions.RedisOptions{
+			Addr:    server.Addr(),
+			Rolling: true,
+		}, &sessions.Options{
+			Path:     "/",
+			HTTPOnly: true,
+			MaxAge:   60,
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		recorder = httptest.NewRecorder()
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal(username, session.Name)
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		server.lock.Lock()
+		assert.Contains(server.cmds, "GETEX")
+		server.lock.Unlock()
+		// cookie is refreshed together with the key
+		c, _ := getCookie(SessionName, recorder)
+		assert.NotNil(c)
+		assert.Equal(60, c.MaxAge)
+	})
+
+	t.Run("RedisStore with parallel Save that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewRedisStore(&sessions.RedisOptions{Addr: server.Addr()})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		sid, _ := getCookie(SessionName, recorder)
+		load := func() *Session {
+			req, _ := http.NewRequest("GET", "/", nil)
+			migrateCookies(recorder, req)
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(httptest.NewRecorder(), req, SessionKeys...))
+			return session
+		}
+
+		first, second := load(), load()
+		first.Name = "first"
+		assert.Nil(first.Save())
+		second.Age = useage
+		assert.Equal(sessions.ErrConflict, second.Save())
+		assert.Equal("first", load().Name)
+
+		//====== a parallel write between WATCH and EXEC =====
+		session := load()
+		val, _, _ := server.get(sid.Value)
+		server.lock.Lock()
+		server.onExec = func() {
+			server.exec([]string{"SET", sid.Value, val, "EX", "60"})
+		}
+		server.lock.Unlock()
+		session.Name = username
+		assert.Equal(sessions.ErrConflict, session.Save())
+		assert.Equal("first", load().Name)
+
+		//====== Save after Destroy =====
+		first, second = load(), load()
+		assert.Nil(first.Destroy())
+		second.Name = "second"
+		assert.Equal(sessions.ErrNotFound, second.Save())
+		_, _, ok := server.get(sid.Value)
+		assert.False(ok)
+	})
+
+	t.Run("RedisStore with unreachable server that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		ln, _ := net.Listen("tcp", "127.0.0.1:0")
+		addr := ln.Addr().String()
+		ln.Close()
+		store := sessions.NewRedisStore(&sessions.RedisOptions{Addr: addr})
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.NotNil(session.Save())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
@@ -0,0 +1,121 @@
+package sessions
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// errNil is returned by readReply for RESP nil bulk strings and arrays.
+var errNil = errors.New("sessions: redis nil reply")
+
+// RedisError is an error reply sent by the redis server.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return string(e)
+}
+
+// redisConn is a single connection speaking the RESP protocol.
+type redisConn struct {
+	conn    net.Conn
+	r       *bufio.Reader
+	w       *bufio.Writer
+	timeout time.Duration
+}
+
+func dialRedis(addr string, timeout time.Duration) (*redisConn, error) {
+	conn, err := net.DialTimeout("tcp", addr, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &redisConn{
+		conn:    conn,
+		r:       bufio.NewReader(conn),
+		w:       bufio.NewWriter(conn),
+		timeout: timeout,
+	}, nil
+}
+
+// do sends a command and reads its reply. Replies are string, int64, []interface{}
+// or nil, error replies are returned as RedisError.
+func (c *redisConn) do(args ...string) (reply interface{}, err error) {
+	if c.timeout > 0 {
+		c.conn.SetDeadline(time.Now().Add(c.timeout))
+	}
+	fmt.Fprintf(c.w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(c.w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err = c.w.Flush(); err != nil {
+		return
+	}
+	reply, err = c.readReply()
+	if err == errNil {
+		return nil, nil
+	}
+	return
+}
+
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		buf := make([]byte, n+2)
+		if _, err = io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, err
+		}
+		if n < 0 {
+			return nil, errNil
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil && err != errNil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("sessions: unexpected redis reply %q", line)
+}
+
+func (c *redisConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("sessions: malformed redis reply %q", line)
+	}
+	return line[:len(line)-2], nil
+}
+
+func (c *redisConn) Close() error {
+	return c.conn.Close()
+}
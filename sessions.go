@@ -1,8 +1,12 @@
 package sessions
 
 import (
+	"crypto/sha256"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
 
 	"github.com/go-http-utils/cookie"
 )
@@ -10,6 +14,23 @@ import (
 // Version is this package's version
 const Version = "1.0.0"
 
+// ErrStoreClosed is returned by stores used after they were closed.
+var ErrStoreClosed = errors.New("sessions: store closed")
+
+// ErrConflict is returned by Save of server stores when the stored session
+// changed since it was loaded, such as by a parallel request of the same
+// browser.
+var ErrConflict = errors.New("sessions: session changed concurrently")
+
+// ErrReadOnly is returned by Save and Destroy for sessions loaded read-only
+// that were changed or destroyed.
+var ErrReadOnly = errors.New("sessions: session is read-only")
+
+// ErrWrittenBeforeResolve is returned by Save and Resolve of a lazy session
+// whose fields were set between Load and Resolve, as its loaded value would either be
+// lost or overwrite them.
+var ErrWrittenBeforeResolve = errors.New("sessions: lazy session written before Resolve")
+
 // Store is an interface for custom session stores.
 type Store interface {
 	// Load should load data from cookie and store, set it into session instance.
@@ -40,14 +61,58 @@ type Sessions interface {
 	IsNew() bool
 }
 
+// Authenticator can be implemented by sessions to tell stores that they
+// belong to a signed-in user. Bounded stores evict anonymous sessions first.
+type Authenticator interface {
+	IsAuthenticated() bool
+}
+
+// Subjecter can be implemented by sessions to bind them to a subject, such
+// as the id of the signed-in user, so that stores implementing OwnerIndex
+// can find them by owner. An empty subject leaves the session unbound.
+type Subjecter interface {
+	SubjectID() string
+}
+
 // Meta stores the values and optional configuration for a session.
 type Meta struct {
+	// TrackChanges makes stores skip encoding the session on Save unless
+	// MarkChanged was called since it was loaded.
+	TrackChanges bool `json:"-"`
+	// ReadOnly, set before Load, makes Save return ErrReadOnly if the
+	// session changed and Destroy return it always, so that no cookie or
+	// store write happens. See NewReadOnlyHandler.
+	ReadOnly bool `json:"-"`
+	// Lazy, set before Load, defers decoding the loaded value until
+	// Resolve is called, and keeps a new session from being saved, and so
+	// from getting a sid or cookie, while it equals its zero value. Fields
+	// of loaded sessions must only be set after Resolve, see
+	// ErrWrittenBeforeResolve.
+	Lazy bool `json:"-"`
+	// Binding and Fingerprint, the one of the request's client, set before
+	// Load, bind new sessions to the client and check loaded ones, see
+	// Binding.
+	Binding     *Binding `json:"-"`
+	Fingerprint string   `json:"-"`
+
 	// Values map[string]interface{}
-	sid       string
-	store     Store
-	name      string
-	cookie    *cookie.Cookies
-	lastValue string
+	sid    string
+	store  Store
+	name   string
+	cookie *cookie.Cookies
+	// digest of the loaded value, so that it is not kept for the request
+	digest [sha256.Size]byte
+	dirty  bool
+	// value and session to decode it into on Resolve, for lazy sessions,
+	// and the session's encoding before any write
+	lazyValue   string
+	lazySession Sessions
+	lazyState   string
+	// fingerprint the loaded session is bound to
+	bound    string
+	mismatch bool
+	// where decodeLoaded keeps the stored value, for wrapping stores
+	record *string
 }
 
 // Init sets current cookie.Cookies and Store to the session instance.
@@ -56,7 +121,8 @@ func (s *Meta) Init(name, sid string, c *cookie.Cookies, store Store, lastValue
 	s.sid = sid
 	s.cookie = c
 	s.store = store
-	s.lastValue = lastValue
+	s.digest = digest(lastValue)
+	s.dirty = false
 }
 
 // GetSID returns the session' sid
@@ -81,7 +147,241 @@ func (s *Meta) GetCookie() *cookie.Cookies {
 
 // IsChanged to check current session's value whether is changed
 func (s *Meta) IsChanged(val string) bool {
-	return s.lastValue != val
+	return s.digest != digest(val)
+}
+
+// MarkChanged marks the session as changed, see TrackChanges.
+func (s *Meta) MarkChanged() {
+	s.dirty = true
+}
+
+// Dirty reports whether MarkChanged was called since the session was loaded.
+func (s *Meta) Dirty() bool {
+	return s.dirty
+}
+
+func (s *Meta) tracksChanges() bool {
+	return s.TrackChanges
+}
+
+func (s *Meta) isReadOnly() bool {
+	return s.ReadOnly
+}
+
+// Resolve decodes the value loaded for a lazy session, on the first call
+// only. Accessors of lazy sessions call it before touching any field, it
+// returns ErrWrittenBeforeResolve and decodes nothing if one was set.
+func (s *Meta) Resolve() error {
+	if s.lazySession == nil {
+		return nil
+	}
+	if err := s.unwritten(); err != nil {
+		return err
+	}
+	value, session := s.lazyValue, s.lazySession
+	s.lazyValue, s.lazySession, s.lazyState = "", nil, ""
+	return Decode(value, &session)
+}
+
+func (s *Meta) isLazy() bool {
+	return s.Lazy
+}
+
+func (s *Meta) deferDecode(value string, session Sessions) {
+	s.lazyValue, s.lazySession = value, session
+	s.lazyState, _ = Encode(session)
+}
+
+func (s *Meta) pending() bool {
+	return s.lazySession != nil
+}
+
+// unwritten returns ErrWrittenBeforeResolve if the pending lazy session
+// changed since its decode was deferred, defaults set before Load aside.
+func (s *Meta) unwritten() error {
+	val, err := Encode(s.lazySession)
+	if err == nil && val != s.lazyState {
+		err = ErrWrittenBeforeResolve
+	}
+	return err
+}
+
+// lazyLoader is implemented by sessions embedding Meta.
+type lazyLoader interface {
+	Resolve() error
+	isLazy() bool
+	deferDecode(value string, session Sessions)
+	pending() bool
+	unwritten() error
+}
+
+// decodeInto decodes the loaded value into session, or defers it until
+// Resolve for lazy sessions.
+func decodeInto(value string, session Sessions) error {
+	if l, ok := session.(lazyLoader); ok && l.isLazy() {
+		l.deferDecode(value, session)
+		return nil
+	}
+	return Decode(value, &session)
+}
+
+// recordLoaded makes decodeLoaded keep the stored value in to, or stop
+// keeping it if to is nil.
+func (s *Meta) recordLoaded(to *string) {
+	s.record = to
+}
+
+func (s *Meta) loaded(stored string) {
+	if s.record != nil {
+		*s.record = stored
+	}
+}
+
+// attach makes store the store of the session, keeping the rest of what
+// Init set.
+func (s *Meta) attach(store Store) {
+	s.store = store
+}
+
+// loadRecorder is implemented by sessions embedding Meta, so that stores
+// wrapping another one learn the value it loaded as stored.
+type loadRecorder interface {
+	recordLoaded(to *string)
+	loaded(stored string)
+}
+
+// attach makes store, a store wrapping the one session was just loaded
+// from, the store session is saved through. Sessions embedding Meta keep
+// the digest of the value the wrapped store loaded, others are initialized
+// again with their encoding.
+func attach(session Sessions, store Store) {
+	if a, ok := session.(interface {
+		attach(store Store)
+	}); ok {
+		a.attach(store)
+		return
+	}
+	var val string
+	if session.IsChanged("") {
+		val, _ = Encode(session)
+	}
+	session.Init(session.GetName(), session.GetSID(), session.GetCookie(), store, val)
+}
+
+// decodeLoaded checks the binding of a stored value and decodes it into
+// session. It returns the encoded value, or "" if the binding rejected it
+// and session is to be loaded as a new one.
+func decodeLoaded(stored string, session Sessions) (string, error) {
+	if r, ok := session.(loadRecorder); ok {
+		r.loaded(stored)
+	}
+	val, err := unbind(stored, session)
+	if val != "" {
+		if e := decodeInto(val, session); e != nil {
+			err = e
+		}
+	}
+	return val, err
+}
+
+// checkStored returns ErrConflict if stored, the live value a server store
+// holds for the sid of session or "" if none, is not the value session was
+// loaded from, and ErrNotFound if that value is gone since. Write-backs of
+// TieredStore are not checked, it resolved their order already.
+func checkStored(session Sessions, stored string) error {
+	if _, ok := session.(*rawSession); ok {
+		return nil
+	}
+	if stored == "" {
+		if session.IsChanged("") {
+			return ErrNotFound
+		}
+		return nil
+	}
+	if val, _ := splitBinding(stored); session.IsChanged(val) {
+		return ErrConflict
+	}
+	return nil
+}
+
+// resolve decodes session if it was loaded lazily, for stores that need
+// its value right after Load.
+func resolve(session Sessions) error {
+	if l, ok := session.(lazyLoader); ok {
+		return l.Resolve()
+	}
+	return nil
+}
+
+// changeTracker is implemented by sessions embedding Meta.
+type changeTracker interface {
+	Dirty() bool
+	tracksChanges() bool
+}
+
+// readOnly reports whether session was loaded read-only.
+func readOnly(session Sessions) bool {
+	r, ok := session.(interface {
+		isReadOnly() bool
+	})
+	return ok && r.isReadOnly()
+}
+
+// encodeChanged returns the encoded session and whether it changed since
+// it was loaded. Sessions tracking their changes are not even encoded
+// unless they were marked changed, and read-only ones return ErrReadOnly
+// if they changed.
+func encodeChanged(session Sessions) (val string, changed bool, err error) {
+	if t, ok := session.(changeTracker); ok && t.tracksChanges() && !t.Dirty() {
+		return
+	}
+	l, lazy := session.(lazyLoader)
+	if lazy = lazy && l.isLazy(); lazy && l.pending() {
+		// never resolved, so unchanged unless written to regardless
+		return "", false, l.unwritten()
+	}
+	if val, err = Encode(session); err != nil {
+		return
+	}
+	changed = session.IsChanged(val)
+	if changed && lazy && session.IsNew() && val == zeroValue(session) {
+		// lazy creation: nothing was written yet
+		return "", false, nil
+	}
+	if changed && readOnly(session) {
+		return "", false, ErrReadOnly
+	}
+	return
+}
+
+// zeroValues caches the encoded zero values of session types.
+var zeroValues = struct {
+	sync.Mutex
+	m map[reflect.Type]string
+}{m: make(map[reflect.Type]string)}
+
+// zeroValue returns the encoded zero value of the type of session.
+func zeroValue(session Sessions) string {
+	t := reflect.TypeOf(session)
+	if t.Kind() != reflect.Ptr {
+		return ""
+	}
+	zeroValues.Lock()
+	defer zeroValues.Unlock()
+	val, ok := zeroValues.m[t]
+	if !ok {
+		val, _ = Encode(reflect.New(t.Elem()).Interface())
+		zeroValues.m[t] = val
+	}
+	return val
+}
+
+// digest returns the SHA-256 of val, or zeros for an empty value.
+func digest(val string) (sum [sha256.Size]byte) {
+	if val != "" {
+		sum = sha256.Sum256([]byte(val))
+	}
+	return
 }
 
 // IsNew to check the current session whether it's new user
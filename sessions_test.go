@@ -1,8 +1,10 @@
 package sessions_test
 
 import (
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 	"time"
 
@@ -28,6 +30,11 @@ func (s *Session) Destroy() error {
 	return s.GetStore().Destroy(s)
 }
 
+// IsAuthenticated ...
+func (s *Session) IsAuthenticated() bool {
+	return s.Authed > 0
+}
+
 func TestSessions(t *testing.T) {
 
 	SessionName := "teambition"
@@ -258,6 +265,99 @@ func TestSessionCompatible(t *testing.T) {
 	})
 }
 
+func TestChangeTracking(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	t.Run("IsChanged by digest that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		meta := &sessions.Meta{}
+		meta.Init(SessionName, "", nil, nil, "value")
+		assert.False(meta.IsChanged("value"))
+		assert.True(meta.IsChanged("valuf"))
+		assert.True(meta.IsChanged(""))
+		meta.Init(SessionName, "", nil, nil, "")
+		assert.False(meta.IsChanged(""))
+	})
+
+	t.Run("TrackChanges that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{TrackChanges: true}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+			assert.Equal(0, store.Len())
+			assert.False(session.Dirty())
+
+			session.MarkChanged()
+			assert.True(session.Dirty())
+			assert.Nil(session.Save())
+			assert.Equal(1, store.Len())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{TrackChanges: true}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Equal(username, session.Name)
+			assert.False(session.Dirty())
+			session.Age = useage
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{TrackChanges: true}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Equal(int64(0), session.Age)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+}
+
+func BenchmarkChangeDetection(b *testing.B) {
+	store := sessions.NewMemoryStore()
+	defer store.Close()
+
+	for _, size := range []int{64, 64 << 10} {
+		session := &Session{Meta: &sessions.Meta{}, Name: strings.Repeat("x", size)}
+		last, _ := sessions.Encode(session)
+
+		b.Run(fmt.Sprintf("%d/string compare", size), func(b *testing.B) {
+			// the previous path: encode and compare with the loaded value
+			for i := 0; i < b.N; i++ {
+				val, _ := sessions.Encode(session)
+				if val != last {
+					b.Fatal("changed")
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("%d/digest", size), func(b *testing.B) {
+			session.Meta = &sessions.Meta{}
+			session.Init("sess", "sid", nil, store, last)
+			for i := 0; i < b.N; i++ {
+				session.Save()
+			}
+		})
+		b.Run(fmt.Sprintf("%d/tracked", size), func(b *testing.B) {
+			session.Meta = &sessions.Meta{TrackChanges: true}
+			session.Init("sess", "sid", nil, store, last)
+			for i := 0; i < b.N; i++ {
+				session.Save()
+			}
+		})
+	}
+}
+
 func getCookie(name string, recorder *httptest.ResponseRecorder) (*http.Cookie, error) {
 	var err error
 	res := &http.Response{Header: http.Header{"Set-Cookie": recorder.HeaderMap["Set-Cookie"]}}
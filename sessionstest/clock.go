@@ -0,0 +1,84 @@
+// Package sessionstest provides utilities for testing code built on sessions.
+package sessionstest
+
+import (
+	"sync"
+	"time"
+
+	"github.com/go-http-utils/cookie-session"
+)
+
+// FakeClock is a sessions.Clock that only moves when told to.
+type FakeClock struct {
+	lock    sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+}
+
+// NewFakeClock returns a FakeClock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+// Now returns the current fake time.
+func (c *FakeClock) Now() time.Time {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.now
+}
+
+// NewTicker returns a ticker driven by Advance.
+func (c *FakeClock) NewTicker(d time.Duration) sessions.Ticker {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	t := &fakeTicker{
+		c:      make(chan time.Time),
+		stop:   make(chan struct{}),
+		period: d,
+		next:   c.now.Add(d),
+	}
+	c.tickers = append(c.tickers, t)
+	return t
+}
+
+// Advance moves the clock forward by d. Every ticker that became due gets
+// one tick, like time.Ticker dropping ticks for slow receivers, and Advance
+// returns only once the tick has been received.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.lock.Lock()
+	c.now = c.now.Add(d)
+	now := c.now
+	var due []*fakeTicker
+	for _, t := range c.tickers {
+		if !t.next.After(now) {
+			for !t.next.After(now) {
+				t.next = t.next.Add(t.period)
+			}
+			due = append(due, t)
+		}
+	}
+	c.lock.Unlock()
+
+	for _, t := range due {
+		select {
+		case t.c <- now:
+		case <-t.stop:
+		}
+	}
+}
+
+type fakeTicker struct {
+	c      chan time.Time
+	stop   chan struct{}
+	once   sync.Once
+	period time.Duration
+	next   time.Time
+}
+
+func (t *fakeTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTicker) Stop() {
+	t.once.Do(func() { close(t.stop) })
+}
@@ -0,0 +1,36 @@
+package sessionstest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-http-utils/cookie-session/sessionstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFakeClock(t *testing.T) {
+	assert := assert.New(t)
+	start := time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := sessionstest.NewFakeClock(start)
+	assert.Equal(start, clock.Now())
+
+	ticker := clock.NewTicker(time.Second)
+	ticks := make(chan time.Time, 10)
+	go func() {
+		for now := range ticker.C() {
+			ticks <- now
+		}
+	}()
+
+	clock.Advance(time.Millisecond * 500)
+	assert.Equal(start.Add(time.Millisecond*500), clock.Now())
+	assert.Equal(0, len(ticks))
+
+	// a single tick even when several periods passed
+	clock.Advance(time.Second * 3)
+	assert.Equal(start.Add(time.Millisecond*3500), <-ticks)
+
+	ticker.Stop()
+	clock.Advance(time.Second * 3)
+	assert.Equal(0, len(ticks))
+}
@@ -0,0 +1,50 @@
+package sessions
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+)
+
+// ErrEmptySIDKey is returned by NewSIDHasher with an empty key, which would
+// make every storage key an HMAC anyone can compute from the sid.
+var ErrEmptySIDKey = errors.New("sessions: SIDHasher needs a non-empty key")
+
+// SIDHasher derives the keys server-side stores keep sessions under from
+// the sids with HMAC-SHA256. A leaked snapshot, dump or table then holds
+// no sid that could be replayed as a cookie.
+//
+// Stores look the keys up in maps, files, indexes or remote servers and
+// never compare them byte by byte with a sid. Such lookups may take longer
+// for some keys, but without the secret a client can not tell which key a
+// guessed sid maps to, so their timing does not reveal how much of the
+// guess is right and no constant-time comparison is needed.
+type SIDHasher struct {
+	key []byte
+}
+
+// NewSIDHasher returns a SIDHasher using key, which must stay secret and
+// stable: changing it makes every stored session unreachable. It returns
+// ErrEmptySIDKey if key is empty.
+func NewSIDHasher(key []byte) (*SIDHasher, error) {
+	if len(key) == 0 {
+		return nil, ErrEmptySIDKey
+	}
+	return &SIDHasher{key: key}, nil
+}
+
+// Hash returns the storage key of sid, as 64 hex chars.
+func (h *SIDHasher) Hash(sid string) string {
+	m := hmac.New(sha256.New, h.key)
+	m.Write([]byte(sid))
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// storageKey returns the key sid is stored under, sid itself without hasher.
+func storageKey(h *SIDHasher, sid string) string {
+	if h == nil {
+		return sid
+	}
+	return h.Hash(sid)
+}
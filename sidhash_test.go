@@ -0,0 +1,104 @@
+package sessions_test
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSIDHasher(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	t.Run("SIDHasher that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		h, err := sessions.NewSIDHasher([]byte("secret"))
+		assert.Nil(err)
+		key := h.Hash("sid")
+		assert.Equal(64, len(key))
+		assert.Equal(key, h.Hash("sid"))
+		other, _ := sessions.NewSIDHasher([]byte("other"))
+		assert.NotEqual(key, other.Hash("sid"))
+	})
+
+	t.Run("NewSIDHasher without key that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		h, err := sessions.NewSIDHasher(nil)
+		assert.Equal(sessions.ErrEmptySIDKey, err)
+		assert.Nil(h)
+		_, err = sessions.NewSIDHasher([]byte{})
+		assert.Equal(sessions.ErrEmptySIDKey, err)
+	})
+
+	t.Run("MemoryStore with SIDHasher that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		h, _ := sessions.NewSIDHasher([]byte("secret"))
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{
+			SIDHasher: h,
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		sid, _ := getCookie(SessionName, recorder)
+
+		var buf bytes.Buffer
+		assert.Nil(store.Snapshot(&buf))
+		assert.False(strings.Contains(buf.String(), sid.Value))
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal(username, session.Name)
+			assert.Nil(session.Destroy())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(0, store.Len())
+	})
+
+	t.Run("RedisStore with SIDHasher that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		server := newFakeRedis(t)
+		defer server.Close()
+
+		h, _ := sessions.NewSIDHasher([]byte("secret"))
+		store := sessions.NewRedisStore(&sessions.RedisOptions{
+			Addr:      server.Addr(),
+			Prefix:    "sess:",
+			SIDHasher: h,
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		sid, _ := getCookie(SessionName, recorder)
+		_, _, ok := server.get("sess:" + sid.Value)
+		assert.False(ok)
+		_, _, ok = server.get("sess:" + h.Hash(sid.Value))
+		assert.True(ok)
+	})
+}
@@ -0,0 +1,187 @@
+package sessions
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+)
+
+// Snapshot format: a 6 bytes header (magic, version, flags) followed by the
+// JSON encoded entries and their SHA-256 checksum. With a SnapshotKey the
+// part after the header is sealed with AES-GCM and prefixed by its nonce.
+const (
+	snapshotMagic     = "SESS"
+	snapshotVersion   = 1
+	snapshotEncrypted = 1 << 0
+)
+
+// Snapshot errors
+var (
+	ErrSnapshotVersion = errors.New("sessions: unsupported snapshot version")
+	ErrInvalidSnapshot = errors.New("sessions: invalid snapshot")
+)
+
+type snapshotEntry struct {
+	SID     string    `json:"sid"`
+	Session string    `json:"session"`
+	Expired time.Time `json:"expired"`
+	Created time.Time `json:"created"`
+	Authed  bool      `json:"authed,omitempty"`
+	Subject string    `json:"subject,omitempty"`
+}
+
+// Snapshot writes every session with its expiry to w.
+func (m *MemoryStore) Snapshot(w io.Writer) (err error) {
+	var entries []snapshotEntry
+	for _, s := range m.shards {
+		s.lock.RLock()
+		for _, value := range s.store {
+			entries = append(entries, snapshotEntry{
+				SID:     value.sid,
+				Session: value.session,
+				Expired: value.expired,
+				Created: value.created,
+				Authed:  value.authed,
+				Subject: value.subject,
+			})
+		}
+		s.lock.RUnlock()
+	}
+	payload, err := json.Marshal(entries)
+	if err != nil {
+		return
+	}
+	sum := sha256.Sum256(payload)
+	body := append(payload, sum[:]...)
+
+	header := []byte(snapshotMagic + "\x00\x00")
+	header[4] = snapshotVersion
+	if m.mopts.SnapshotKey != nil {
+		header[5] |= snapshotEncrypted
+		if body, err = m.seal(header, body); err != nil {
+			return
+		}
+	}
+	if _, err = w.Write(header); err != nil {
+		return
+	}
+	_, err = w.Write(body)
+	return
+}
+
+// Restore reads sessions written by Snapshot from r. Sessions that have
+// expired in the meantime are skipped, existing ones with the same sid are
+// replaced. Stores with a SnapshotKey only accept encrypted snapshots, as
+// anyone could forge the checksum of a plain one.
+func (m *MemoryStore) Restore(r io.Reader) (err error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return
+	}
+	if len(b) < 6 || string(b[:4]) != snapshotMagic {
+		return ErrInvalidSnapshot
+	}
+	header, body := b[:6], b[6:]
+	if header[4] != snapshotVersion {
+		return ErrSnapshotVersion
+	}
+	if header[5]&snapshotEncrypted != 0 {
+		if body, err = m.open(header, body); err != nil {
+			return
+		}
+	} else if m.mopts.SnapshotKey != nil {
+		return ErrInvalidSnapshot
+	}
+	if len(body) < sha256.Size {
+		return ErrInvalidSnapshot
+	}
+	payload, checksum := body[:len(body)-sha256.Size], body[len(body)-sha256.Size:]
+	if sum := sha256.Sum256(payload); !bytes.Equal(sum[:], checksum) {
+		return ErrInvalidSnapshot
+	}
+	var entries []snapshotEntry
+	if err = json.Unmarshal(payload, &entries); err != nil {
+		return
+	}
+	now := m.clock.Now()
+	for _, entry := range entries {
+		if !entry.Expired.After(now) {
+			continue
+		}
+		m.put(&sessionValue{
+			session: entry.Session,
+			expired: entry.Expired,
+			created: entry.Created,
+			sid:     entry.SID,
+			authed:  entry.Authed,
+			subject: entry.Subject,
+		}, nil)
+	}
+	return
+}
+
+// RestoreErr returns the error met restoring MemoryOptions.SnapshotPath in
+// the constructor, such as a wrong SnapshotKey or a corrupt file. Missing
+// snapshots are not an error.
+func (m *MemoryStore) RestoreErr() error {
+	return m.restoreErr
+}
+
+func (m *MemoryStore) snapshotFile(path string) error {
+	return writeFileAtomic(path, m.Snapshot)
+}
+
+func (m *MemoryStore) restoreFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return m.Restore(f)
+}
+
+func (m *MemoryStore) seal(header, body []byte) ([]byte, error) {
+	gcm, err := m.gcm()
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err = io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	return gcm.Seal(nonce, nonce, body, header), nil
+}
+
+func (m *MemoryStore) open(header, body []byte) ([]byte, error) {
+	if m.mopts.SnapshotKey == nil {
+		return nil, ErrInvalidSnapshot
+	}
+	gcm, err := m.gcm()
+	if err != nil {
+		return nil, err
+	}
+	if len(body) < gcm.NonceSize() {
+		return nil, ErrInvalidSnapshot
+	}
+	body, err = gcm.Open(nil, body[:gcm.NonceSize()], body[gcm.NonceSize():], header)
+	if err != nil {
+		return nil, ErrInvalidSnapshot
+	}
+	return body, nil
+}
+
+func (m *MemoryStore) gcm() (cipher.AEAD, error) {
+	block, err := aes.NewCipher(m.mopts.SnapshotKey)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,180 @@
+package sessions_test
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/go-http-utils/cookie-session/sessionstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStoreSnapshot(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+	key := []byte("0123456789abcdef0123456789abcdef")
+
+	// save returns the cookies of a new session saved to store
+	save := func(store *sessions.MemoryStore, name string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/", nil)
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = name
+			session.Save()
+		})
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+	load := func(store *sessions.MemoryStore, recorder *httptest.ResponseRecorder) string {
+		req, _ := http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		var name string
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			name = session.Name
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		return name
+	}
+
+	t.Run("Snapshot and Restore that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		clock := sessionstest.NewFakeClock(time.Now())
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{Clock: clock})
+		defer store.Close()
+		short := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{Clock: clock}, &sessions.Options{
+			Path:     "/",
+			HTTPOnly: true,
+			MaxAge:   1,
+		})
+		defer short.Close()
+
+		first := save(store, username)
+		expiring := save(short, secondUserName)
+
+		var b1, b2 bytes.Buffer
+		assert.Nil(store.Snapshot(&b1))
+		assert.Nil(short.Snapshot(&b2))
+
+		clock.Advance(time.Second * 2)
+		restored := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{Clock: clock})
+		defer restored.Close()
+		assert.Nil(restored.Restore(&b1))
+		assert.Nil(restored.Restore(&b2))
+
+		assert.Equal(1, restored.Len())
+		assert.Equal(username, load(restored, first))
+		assert.Equal("", load(restored, expiring))
+
+		// the creation time survives, for LimitEvictOldest
+		before, _ := store.Sessions()
+		after, _ := restored.Sessions()
+		assert.Equal(1, len(after))
+		assert.True(before[0].Created.Equal(after[0].Created))
+	})
+
+	t.Run("Snapshot with encryption that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{SnapshotKey: key})
+		defer store.Close()
+		recorder := save(store, username)
+
+		var buf bytes.Buffer
+		assert.Nil(store.Snapshot(&buf))
+		assert.False(bytes.Contains(buf.Bytes(), []byte(recorder.Result().Cookies()[0].Value)))
+		data := buf.Bytes()
+
+		plain := sessions.NewMemoryStore()
+		defer plain.Close()
+		assert.Equal(sessions.ErrInvalidSnapshot, plain.Restore(bytes.NewReader(data)))
+
+		restored := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{SnapshotKey: key})
+		defer restored.Close()
+		assert.Nil(restored.Restore(bytes.NewReader(data)))
+		assert.Equal(username, load(restored, recorder))
+
+		//====== plain snapshots are refused with a key =====
+		buf.Reset()
+		planted := save(plain, secondUserName)
+		assert.Nil(plain.Snapshot(&buf))
+		assert.Equal(sessions.ErrInvalidSnapshot, restored.Restore(bytes.NewReader(buf.Bytes())))
+		assert.Equal("", load(restored, planted))
+	})
+
+	t.Run("Restore with corrupted snapshot that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+		save(store, username)
+
+		var buf bytes.Buffer
+		assert.Nil(store.Snapshot(&buf))
+		data := buf.Bytes()
+
+		tampered := append([]byte{}, data...)
+		tampered[10] ^= 0xff
+		assert.Equal(sessions.ErrInvalidSnapshot, store.Restore(bytes.NewReader(tampered)))
+
+		newer := append([]byte{}, data...)
+		newer[4] = 99
+		assert.Equal(sessions.ErrSnapshotVersion, store.Restore(bytes.NewReader(newer)))
+
+		assert.Equal(sessions.ErrInvalidSnapshot, store.Restore(bytes.NewReader([]byte("xx"))))
+	})
+
+	t.Run("Snapshot to SnapshotPath across restarts that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "sessions")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "sessions.snapshot")
+
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{SnapshotPath: path})
+		recorder := save(store, username)
+		store.Close()
+
+		restarted := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{SnapshotPath: path})
+		defer restarted.Close()
+		assert.Nil(restarted.RestoreErr())
+		assert.Equal(username, load(restarted, recorder))
+	})
+
+	t.Run("SnapshotPath failing to restore that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		dir, err := ioutil.TempDir("", "sessions")
+		assert.Nil(err)
+		defer os.RemoveAll(dir)
+		path := filepath.Join(dir, "sessions.snapshot")
+
+		store := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{SnapshotPath: path, SnapshotKey: key})
+		recorder := save(store, username)
+		assert.Nil(store.Shutdown(context.Background()))
+		data, err := ioutil.ReadFile(path)
+		assert.Nil(err)
+
+		other := []byte("fedcba9876543210fedcba9876543210")
+		wrong := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{SnapshotPath: path, SnapshotKey: other})
+		assert.Equal(sessions.ErrInvalidSnapshot, wrong.RestoreErr())
+		assert.Equal(0, wrong.Len())
+		assert.Equal(sessions.ErrInvalidSnapshot, wrong.Shutdown(context.Background()))
+		kept, err := ioutil.ReadFile(path)
+		assert.Nil(err)
+		assert.Equal(data, kept)
+
+		restarted := sessions.NewMemoryStoreWithOptions(&sessions.MemoryOptions{SnapshotPath: path, SnapshotKey: key})
+		defer restarted.Close()
+		assert.Equal(username, load(restarted, recorder))
+	})
+}
@@ -0,0 +1,10 @@
+//go:build sqlite
+// +build sqlite
+
+// The SQLStore tests need a driver registered as "sqlite". The pure-Go one
+// does not build on the older Go versions of the CI matrix, so it is only
+// linked in with: go test -tags sqlite
+
+package sessions_test
+
+import _ "modernc.org/sqlite"
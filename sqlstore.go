@@ -0,0 +1,305 @@
+package sessions
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+)
+
+// Dialect describes the SQL flavour a SQLStore talks to.
+type Dialect interface {
+	// Placeholder returns the bind parameter for the n-th (1-based) argument.
+	Placeholder(n int) string
+	// CreateTable returns the statements that create the sessions table.
+	CreateTable(table string) []string
+	// Upsert returns the statement that inserts or replaces a session,
+	// taking sid, session and expired as arguments.
+	Upsert(table string) string
+}
+
+// Built-in dialects for the most common databases.
+var (
+	SQLite     Dialect = sqliteDialect{}
+	PostgreSQL Dialect = postgresDialect{}
+	MySQL      Dialect = mysqlDialect{}
+)
+
+type sqliteDialect struct{}
+
+func (sqliteDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (sqliteDialect) CreateTable(table string) []string {
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (sid VARCHAR(255) PRIMARY KEY, session TEXT NOT NULL, expired BIGINT NOT NULL)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expired ON %s (expired)", table, table),
+	}
+}
+
+func (sqliteDialect) Upsert(table string) string {
+	return fmt.Sprintf("INSERT INTO %s (sid, session, expired) VALUES (?, ?, ?) "+
+		"ON CONFLICT (sid) DO UPDATE SET session = excluded.session, expired = excluded.expired", table)
+}
+
+type postgresDialect struct{}
+
+func (postgresDialect) Placeholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func (postgresDialect) CreateTable(table string) []string {
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (sid VARCHAR(255) PRIMARY KEY, session TEXT NOT NULL, expired BIGINT NOT NULL)", table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_expired ON %s (expired)", table, table),
+	}
+}
+
+func (postgresDialect) Upsert(table string) string {
+	return fmt.Sprintf("INSERT INTO %s (sid, session, expired) VALUES ($1, $2, $3) "+
+		"ON CONFLICT (sid) DO UPDATE SET session = EXCLUDED.session, expired = EXCLUDED.expired", table)
+}
+
+type mysqlDialect struct{}
+
+func (mysqlDialect) Placeholder(n int) string {
+	return "?"
+}
+
+func (mysqlDialect) CreateTable(table string) []string {
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (sid VARCHAR(255) NOT NULL PRIMARY KEY, session MEDIUMTEXT NOT NULL, expired BIGINT NOT NULL, INDEX %s_expired (expired))", table, table),
+	}
+}
+
+func (mysqlDialect) Upsert(table string) string {
+	return fmt.Sprintf("INSERT INTO %s (sid, session, expired) VALUES (?, ?, ?) "+
+		"ON DUPLICATE KEY UPDATE session = VALUES(session), expired = VALUES(expired)", table)
+}
+
+// SQLOptions stores the configuration of a SQLStore.
+type SQLOptions struct {
+	// SweepInterval is how often expired rows are deleted, defaults to 1 minute.
+	SweepInterval time.Duration
+	// Clock is the source of time for expiry, defaults to the system clock.
+	Clock Clock
+	// IDGenerator creates and validates sids, defaults to DefaultIDGenerator.
+	IDGenerator IDGenerator
+	// SIDHasher, when set, stores a keyed hash of each sid in the sid column
+	// instead of the sid itself.
+	SIDHasher *SIDHasher
+}
+
+// NewSQLStore returns an SQLStore instance which keeps sessions in table.
+// The table is not created automatically, call CreateTable for that.
+func NewSQLStore(db *sql.DB, dialect Dialect, table string, options ...*Options) (store *SQLStore) {
+	return NewSQLStoreWithOptions(db, dialect, table, nil, options...)
+}
+
+// NewSQLStoreWithOptions returns an SQLStore instance configured by sqlOptions.
+func NewSQLStoreWithOptions(db *sql.DB, dialect Dialect, table string, sqlOptions *SQLOptions, options ...*Options) (store *SQLStore) {
+	sopts := SQLOptions{}
+	if sqlOptions != nil {
+		sopts = *sqlOptions
+	}
+	if sopts.SweepInterval <= 0 {
+		sopts.SweepInterval = time.Minute
+	}
+	if sopts.Clock == nil {
+		sopts.Clock = realClock{}
+	}
+	if sopts.IDGenerator == nil {
+		sopts.IDGenerator = DefaultIDGenerator
+	}
+	p := dialect.Placeholder
+	store = &SQLStore{
+		db:      db,
+		dialect: dialect,
+		table:   table,
+		sopts:   sopts,
+		opts:    newCookieOptions(false, options), // signing not necessary
+		ticker:  sopts.Clock.NewTicker(sopts.SweepInterval),
+		done:    make(chan bool, 1),
+		stopped: make(chan struct{}),
+
+		selectQuery: fmt.Sprintf("SELECT session FROM %s WHERE sid = %s AND expired > %s", table, p(1), p(2)),
+		upsertQuery: dialect.Upsert(table),
+		updateQuery: fmt.Sprintf("UPDATE %s SET session = %s, expired = %s WHERE sid = %s AND session = %s AND expired > %s",
+			table, p(1), p(2), p(3), p(4), p(5)),
+		deleteQuery: fmt.Sprintf("DELETE FROM %s WHERE sid = %s", table, p(1)),
+		sweepQuery:  fmt.Sprintf("DELETE FROM %s WHERE expired <= %s", table, p(1)),
+	}
+
+	go store.cleanCache()
+	return
+}
+
+// SQLStore using a database/sql table to store sessions base on secure cookies.
+type SQLStore struct {
+	db      *sql.DB
+	dialect Dialect
+	table   string
+	sopts   SQLOptions
+	opts    *cookie.Options
+	ticker  Ticker
+	done    chan bool
+	stopped chan struct{}
+
+	closeOnce sync.Once
+
+	selectQuery string
+	upsertQuery string
+	updateQuery string
+	deleteQuery string
+	sweepQuery  string
+}
+
+// CreateTable creates the sessions table and its index if they don't exist.
+func (s *SQLStore) CreateTable() error {
+	for _, stmt := range s.dialect.CreateTable(s.table) {
+		if _, err := s.db.Exec(stmt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Load a session by name and any kind of stores
+func (s *SQLStore) Load(name string, session Sessions, cookie *cookie.Cookies) error {
+	sid, err := readSID(cookie, name, s.opts, s.sopts.IDGenerator)
+	var result string
+	if sid != "" {
+		// expired rows are filtered out here, even before Sweep removes them
+		key := storageKey(s.sopts.SIDHasher, sid)
+		e := s.db.QueryRow(s.selectQuery, key, s.sopts.Clock.Now().Unix()).Scan(&result)
+		if e != nil && e != sql.ErrNoRows {
+			err = e
+		}
+	}
+	if result != "" {
+		if result, err = decodeLoaded(result, session); result == "" {
+			sid = ""
+		}
+	}
+	session.Init(name, sid, cookie, s, result)
+	return err
+}
+
+// Save session to Response's cookie
+func (s *SQLStore) Save(session Sessions) (err error) {
+	val, changed, err := encodeChanged(session)
+	if err != nil || !changed {
+		return
+	}
+	sid := session.GetSID()
+	_, raw := session.(*rawSession)
+	if sid == "" {
+		if sid, err = s.sopts.IDGenerator.NewID(); err != nil {
+			return
+		}
+		raw = true
+	}
+	key := storageKey(s.sopts.SIDHasher, sid)
+	expired := s.sopts.Clock.Now().Add(time.Duration(s.opts.MaxAge) * time.Second).Unix()
+	if raw {
+		_, err = s.db.Exec(s.upsertQuery, key, bind(session, val), expired)
+	} else {
+		err = s.update(session, key, bind(session, val), expired)
+	}
+	if err != nil {
+		return
+	}
+	session.GetCookie().Set(session.GetName(), sid, s.opts)
+	return
+}
+
+// update replaces the loaded session at key only if the row still holds
+// the value read before, returning ErrConflict if another Save won the
+// race, see checkStored.
+func (s *SQLStore) update(session Sessions, key, val string, expired int64) error {
+	stored, err := s.stored(key)
+	if err != nil {
+		return err
+	}
+	if err = checkStored(session, stored); err != nil {
+		return err
+	}
+	if stored == "" {
+		_, err = s.db.Exec(s.upsertQuery, key, val, expired)
+		return err
+	}
+	res, err := s.db.Exec(s.updateQuery, val, expired, key, stored, s.sopts.Clock.Now().Unix())
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n > 0 {
+		return err
+	}
+	// the row changed since it was read, or MySQL counted an update
+	// writing the same values as none
+	if stored, err = s.stored(key); err != nil {
+		return err
+	}
+	switch stored {
+	case "":
+		return ErrNotFound
+	case val:
+		return nil
+	}
+	return ErrConflict
+}
+
+// stored returns the live value of key, or "" if there is none.
+func (s *SQLStore) stored(key string) (val string, err error) {
+	err = s.db.QueryRow(s.selectQuery, key, s.sopts.Clock.Now().Unix()).Scan(&val)
+	if err == sql.ErrNoRows {
+		err = nil
+	}
+	return
+}
+
+// Destroy destroy the session
+func (s *SQLStore) Destroy(session Sessions) (err error) {
+	if readOnly(session) {
+		return ErrReadOnly
+	}
+	sid := session.GetSID()
+	if sid != "" {
+		if _, err = s.db.Exec(s.deleteQuery, storageKey(s.sopts.SIDHasher, sid)); err != nil {
+			return
+		}
+	}
+	session.GetCookie().Remove(session.GetName(), s.opts)
+	return
+}
+
+// Sweep deletes all expired rows from the table.
+func (s *SQLStore) Sweep() (err error) {
+	_, err = s.db.Exec(s.sweepQuery, s.sopts.Clock.Now().Unix())
+	return
+}
+
+// Close stops the goroutine cleanCache thread and waits for it to exit. It
+// can be called more than once.
+func (s *SQLStore) Close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+	<-s.stopped
+}
+
+func (s *SQLStore) cleanCache() {
+	defer close(s.stopped)
+	defer s.ticker.Stop()
+	for {
+		select {
+		case <-s.ticker.C():
+			s.Sweep()
+		case <-s.done:
+			return
+		}
+	}
+}
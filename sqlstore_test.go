@@ -0,0 +1,193 @@
+package sessions_test
+
+import (
+	"database/sql"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/go-http-utils/cookie-session/sessionstest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQLStore(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	dir, err := ioutil.TempDir("", "sessions")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	db, err := sql.Open("sqlite", filepath.Join(dir, "sessions.db"))
+	if err != nil {
+		t.Skip("no sqlite driver, run with -tags sqlite")
+	}
+	defer db.Close()
+
+	t.Run("SQLStore use default options that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewSQLStore(db, sessions.SQLite, "sessions")
+		defer store.Close()
+		assert.Nil(store.CreateTable())
+		// creating twice is harmless
+		assert.Nil(store.CreateTable())
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Age = useage
+			assert.Nil(session.Save())
+			assert.True(session.IsNew())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		//====== update session =====
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+
+			assert.Equal(username, session.Name)
+			assert.False(session.IsNew())
+			session.Age = secondUsage
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		//====== reuse and destroy session =====
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+
+			assert.Equal(username, session.Name)
+			assert.Equal(secondUsage, session.Age)
+			assert.Nil(session.Destroy())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Equal("", session.Name)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("SQLStore with parallel Save that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewSQLStore(db, sessions.SQLite, "parallel")
+		defer store.Close()
+		assert.Nil(store.CreateTable())
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		load := func() *Session {
+			req, _ := http.NewRequest("GET", "/", nil)
+			migrateCookies(recorder, req)
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(httptest.NewRecorder(), req, SessionKeys...))
+			return session
+		}
+
+		first, second := load(), load()
+		first.Name = "first"
+		assert.Nil(first.Save())
+		second.Age = useage
+		assert.Equal(sessions.ErrConflict, second.Save())
+		assert.Equal("first", load().Name)
+
+		//====== Save after Destroy =====
+		first, second = load(), load()
+		assert.Nil(first.Destroy())
+		second.Name = "second"
+		assert.Equal(sessions.ErrNotFound, second.Save())
+	})
+
+	t.Run("SQLStore with expired sessions that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		clock := sessionstest.NewFakeClock(time.Now())
+		store := sessions.NewSQLStoreWithOptions(db, sessions.SQLite, "expiring", &sessions.SQLOptions{
+			Clock: clock,
+		}, &sessions.Options{
+			Path:     "/",
+			HTTPOnly: true,
+			MaxAge:   1,
+		})
+		defer store.Close()
+		assert.Nil(store.CreateTable())
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		clock.Advance(time.Second * 2)
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		for _, c := range recorder.Result().Cookies() {
+			req.AddCookie(c)
+		}
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Equal("", session.Name)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		var count int
+		assert.Nil(store.Sweep())
+		assert.Nil(db.QueryRow("SELECT COUNT(*) FROM expiring").Scan(&count))
+		assert.Equal(0, count)
+	})
+}
+
+func TestSQLStoreClose(t *testing.T) {
+	assert := assert.New(t)
+	// the database is only used by the sweeper, which never ticks here
+	store := sessions.NewSQLStore(nil, sessions.SQLite, "sessions")
+	store.Close()
+	assert.NotPanics(store.Close)
+}
+
+func TestSQLDialect(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("?", sessions.SQLite.Placeholder(2))
+	assert.Equal("?", sessions.MySQL.Placeholder(2))
+	assert.Equal("$2", sessions.PostgreSQL.Placeholder(2))
+
+	assert.True(strings.Contains(sessions.SQLite.Upsert("sess"), "ON CONFLICT (sid)"))
+	assert.True(strings.Contains(sessions.PostgreSQL.Upsert("sess"), "VALUES ($1, $2, $3)"))
+	assert.True(strings.Contains(sessions.MySQL.Upsert("sess"), "ON DUPLICATE KEY UPDATE"))
+
+	for _, d := range []sessions.Dialect{sessions.SQLite, sessions.PostgreSQL, sessions.MySQL} {
+		stmts := d.CreateTable("sess")
+		assert.True(len(stmts) > 0)
+		assert.True(strings.HasPrefix(stmts[0], "CREATE TABLE IF NOT EXISTS sess "))
+	}
+}
@@ -0,0 +1,340 @@
+package sessions
+
+import (
+	"encoding/base64"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+)
+
+// TieredOptions stores the caching configuration of a TieredStore.
+type TieredOptions struct {
+	// WriteBack makes Save only update the local cache, the backing store is
+	// written by a background flush every FlushInterval and on Close.
+	// By default Save writes through to the backing store.
+	WriteBack bool
+	// LocalTTL is how long a loaded session is served from the local cache,
+	// defaults to 5 seconds.
+	LocalTTL time.Duration
+	// NegativeTTL is how long an unknown sid is remembered as missing,
+	// defaults to 1 second. A negative value disables negative caching.
+	NegativeTTL time.Duration
+	// FlushInterval is the write-back period, defaults to 1 second.
+	FlushInterval time.Duration
+	// Clock is the source of time for the local cache, defaults to the
+	// system clock.
+	Clock Clock
+	// IDGenerator creates and validates sids, defaults to DefaultIDGenerator.
+	// It should accept the sids of the backend.
+	IDGenerator IDGenerator
+}
+
+// NewTieredStore returns an TieredStore instance which caches the sessions
+// of backend in memory. options should be the same as the backend's.
+func NewTieredStore(backend Store, tieredOptions *TieredOptions, options ...*Options) (store *TieredStore) {
+	topts := TieredOptions{}
+	if tieredOptions != nil {
+		topts = *tieredOptions
+	}
+	if topts.LocalTTL <= 0 {
+		topts.LocalTTL = 5 * time.Second
+	}
+	if topts.NegativeTTL == 0 {
+		topts.NegativeTTL = time.Second
+	}
+	if topts.FlushInterval <= 0 {
+		topts.FlushInterval = time.Second
+	}
+	if topts.Clock == nil {
+		topts.Clock = realClock{}
+	}
+	if topts.IDGenerator == nil {
+		topts.IDGenerator = DefaultIDGenerator
+	}
+	store = &TieredStore{
+		backend:  backend,
+		topts:    topts,
+		opts:     newCookieOptions(false, options), // signing not necessary
+		cache:    make(map[string]*cacheValue),
+		pending:  make(map[string]*pendingValue),
+		flushing: make(map[string]*pendingValue),
+		ticker:   topts.Clock.NewTicker(topts.FlushInterval),
+		done:     make(chan bool, 1),
+		stopped:  make(chan struct{}),
+	}
+
+	go store.cleanCache()
+	return
+}
+
+// cacheValue is a locally cached session, an empty session marks a sid
+// unknown to the backend.
+type cacheValue struct {
+	expired time.Time
+	session string
+}
+
+// pendingValue is a session waiting to be written back.
+type pendingValue struct {
+	name    string
+	session string
+	// destroyed is set when the session is destroyed while being flushed
+	destroyed bool
+}
+
+// TieredStore using a local memory cache in front of another store.
+type TieredStore struct {
+	backend Store
+	topts   TieredOptions
+	opts    *cookie.Options
+	cache   map[string]*cacheValue
+	pending map[string]*pendingValue
+	// sessions being written by Flush, which runs one at a time
+	flushing  map[string]*pendingValue
+	flushLock sync.Mutex
+	ticker    Ticker
+	lock      sync.Mutex
+	done      chan bool
+	stopped   chan struct{}
+	closeOnce sync.Once
+}
+
+// Load a session by name and any kind of stores, the backend is only asked
+// on a local cache miss.
+func (t *TieredStore) Load(name string, session Sessions, cookie *cookie.Cookies) error {
+	sid, err := readSID(cookie, name, t.opts, t.topts.IDGenerator)
+	if err == ErrInvalidSID {
+		session.Init(name, "", cookie, t, "")
+		return err
+	}
+	if sid != "" {
+		if stored, ok := t.get(sid); ok {
+			var result string
+			if stored != "" {
+				if result, err = decodeLoaded(stored, session); result == "" {
+					sid = ""
+				}
+			}
+			session.Init(name, sid, cookie, t, result)
+			return err
+		}
+	}
+
+	// the value is cached as stored, bound, so that hits check the binding
+	// and get the digest the backend compares Save against
+	var stored string
+	r, recording := session.(loadRecorder)
+	if recording {
+		r.recordLoaded(&stored)
+	}
+	err = t.backend.Load(name, session, cookie)
+	if recording {
+		r.recordLoaded(nil)
+	}
+	sid = session.GetSID()
+	if sid != "" && err == nil {
+		// IsChanged("") reports whether the backend found a value at all
+		if session.IsChanged("") {
+			if !recording {
+				var val string
+				if val, err = Encode(session); err == nil {
+					stored = bind(session, val)
+				}
+			}
+			if err == nil {
+				t.set(sid, stored, t.topts.LocalTTL)
+			}
+		} else if t.topts.NegativeTTL > 0 {
+			t.set(sid, "", t.topts.NegativeTTL)
+		}
+	}
+	attach(session, t)
+	return err
+}
+
+// Save session to the local cache and, unless in write-back mode, to the
+// backend. A new session gets its sid assigned here, so that both tiers
+// agree on it.
+func (t *TieredStore) Save(session Sessions) (err error) {
+	val, changed, err := encodeChanged(session)
+	if err != nil || !changed {
+		return
+	}
+	sid := session.GetSID()
+	if sid == "" {
+		if sid, err = t.topts.IDGenerator.NewID(); err != nil {
+			return
+		}
+		session.Init(session.GetName(), sid, session.GetCookie(), t, "")
+	}
+	if !t.topts.WriteBack {
+		if err = t.backend.Save(session); err != nil {
+			t.invalidate(sid)
+			return
+		}
+		t.set(sid, bind(session, val), t.topts.LocalTTL)
+		return
+	}
+	stored := bind(session, val)
+	t.lock.Lock()
+	t.pending[sid] = &pendingValue{name: session.GetName(), session: stored}
+	t.cache[sid] = &cacheValue{session: stored, expired: t.topts.Clock.Now().Add(t.topts.LocalTTL)}
+	t.lock.Unlock()
+	session.GetCookie().Set(session.GetName(), sid, t.opts)
+	return
+}
+
+// Destroy destroy the session in both tiers
+func (t *TieredStore) Destroy(session Sessions) (err error) {
+	if readOnly(session) {
+		return ErrReadOnly
+	}
+	if sid := session.GetSID(); sid != "" {
+		t.invalidate(sid)
+	}
+	return t.backend.Destroy(session)
+}
+
+// Flush writes all pending sessions to the backend. A session destroyed
+// while it is written is destroyed in the backend again afterwards, so that
+// the flush does not bring it back.
+func (t *TieredStore) Flush() (err error) {
+	t.flushLock.Lock()
+	defer t.flushLock.Unlock()
+	t.lock.Lock()
+	pending := t.pending
+	t.pending = make(map[string]*pendingValue)
+	for sid, val := range pending {
+		t.flushing[sid] = val
+	}
+	t.lock.Unlock()
+
+	for sid, val := range pending {
+		value, fingerprint := splitBinding(val.session)
+		session := &rawSession{Meta: &Meta{bound: fingerprint}, value: value}
+		session.Init(val.name, sid, detachedCookie(), t.backend, "")
+		e := t.backend.Save(session)
+
+		t.lock.Lock()
+		delete(t.flushing, sid)
+		destroyed := val.destroyed
+		if e != nil && !destroyed {
+			// keep it for the next flush unless a newer value arrived
+			if _, ok := t.pending[sid]; !ok {
+				t.pending[sid] = val
+			}
+		}
+		t.lock.Unlock()
+		if e != nil {
+			err = e
+		} else if destroyed {
+			if e = t.backend.Destroy(session); e != nil {
+				err = e
+			}
+		}
+	}
+	return
+}
+
+// Len returns the number of locally cached sessions
+func (t *TieredStore) Len() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return len(t.cache)
+}
+
+// Close stops the goroutine cleanCache thread, waits for it to exit and
+// flushes pending sessions. It can be called more than once.
+func (t *TieredStore) Close() {
+	t.closeOnce.Do(func() {
+		close(t.done)
+	})
+	<-t.stopped
+	t.Flush()
+}
+
+func (t *TieredStore) get(sid string) (string, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if val, ok := t.pending[sid]; ok {
+		return val.session, true
+	}
+	if val, ok := t.cache[sid]; ok && val.expired.After(t.topts.Clock.Now()) {
+		return val.session, true
+	}
+	return "", false
+}
+
+func (t *TieredStore) set(sid, val string, ttl time.Duration) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.cache[sid] = &cacheValue{session: val, expired: t.topts.Clock.Now().Add(ttl)}
+}
+
+func (t *TieredStore) invalidate(sid string) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	delete(t.cache, sid)
+	delete(t.pending, sid)
+	if val, ok := t.flushing[sid]; ok {
+		val.destroyed = true
+	}
+}
+
+func (t *TieredStore) cleanCache() {
+	defer close(t.stopped)
+	defer t.ticker.Stop()
+	for {
+		select {
+		case now := <-t.ticker.C():
+			t.clean(now)
+			if t.topts.WriteBack {
+				t.Flush()
+			}
+		case <-t.done:
+			return
+		}
+	}
+}
+
+func (t *TieredStore) clean(now time.Time) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	for sid, val := range t.cache {
+		if val.expired.Before(now) {
+			delete(t.cache, sid)
+		}
+	}
+}
+
+// rawSession replays an already encoded session value, so that it can be
+// saved to any Store without knowing the user's session type.
+type rawSession struct {
+	*Meta
+	value string
+}
+
+// MarshalJSON returns the JSON the value was encoded from.
+func (r *rawSession) MarshalJSON() ([]byte, error) {
+	return base64.StdEncoding.DecodeString(r.value)
+}
+
+// detachedCookie returns cookies bound to no response, for writes that
+// happen outside of a request.
+func detachedCookie() *cookie.Cookies {
+	return cookie.New(discardResponse{}, &http.Request{Header: http.Header{}})
+}
+
+type discardResponse struct{}
+
+func (discardResponse) Header() http.Header {
+	return http.Header{}
+}
+
+func (discardResponse) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (discardResponse) WriteHeader(int) {}
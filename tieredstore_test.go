@@ -0,0 +1,304 @@
+package sessions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/go-http-utils/cookie-session/sessionstest"
+	"github.com/stretchr/testify/assert"
+)
+
+// countingStore counts the calls that reach the wrapped store.
+type countingStore struct {
+	sessions.Store
+	loads int32
+	saves int32
+}
+
+func (c *countingStore) Load(name string, session sessions.Sessions, cookie *cookie.Cookies) error {
+	atomic.AddInt32(&c.loads, 1)
+	return c.Store.Load(name, session, cookie)
+}
+
+func (c *countingStore) Save(session sessions.Sessions) error {
+	atomic.AddInt32(&c.saves, 1)
+	return c.Store.Save(session)
+}
+
+// blockingStore holds every Save until release is closed.
+type blockingStore struct {
+	sessions.Store
+	saving  chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingStore) Save(session sessions.Sessions) error {
+	b.saving <- struct{}{}
+	<-b.release
+	return b.Store.Save(session)
+}
+
+// WiderSession is Session after a new field was added to it.
+type WiderSession struct {
+	*sessions.Meta `json:"-"`
+	Name           string `json:"name"`
+	Age            int64  `json:"age"`
+	Authed         int64  `json:"authed"`
+	Lang           string `json:"lang"`
+}
+
+func (s *WiderSession) Save() error {
+	return s.GetStore().Save(s)
+}
+
+func TestWrappingStores(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	memory := sessions.NewMemoryStore()
+	defer memory.Close()
+	req, _ := http.NewRequest("GET", "/", nil)
+	recorder := httptest.NewRecorder()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		session := &Session{Meta: &sessions.Meta{}}
+		memory.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+		session.Name = username
+		session.Save()
+	})
+	handler.ServeHTTP(recorder, req)
+
+	// save loads the stored session as WiderSession through store, whose
+	// encoding does not match the stored value byte for byte, and saves it
+	// unless lang is empty
+	save := func(store sessions.Store, lang string) error {
+		req, _ := http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		session := &WiderSession{Meta: &sessions.Meta{}}
+		store.Load(SessionName, session, cookie.New(httptest.NewRecorder(), req, SessionKeys...))
+		if session.Name != username {
+			return sessions.ErrNotFound
+		}
+		if lang == "" {
+			return nil
+		}
+		session.Lang = lang
+		return session.Save()
+	}
+
+	t.Run("TieredStore after a session type change that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewTieredStore(memory, nil)
+		defer store.Close()
+		// cached as stored, so that a later hit still matches the backend
+		assert.Nil(save(store, ""))
+		assert.Nil(save(store, "en"))
+	})
+
+	t.Run("LimitedStore after a session type change that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewLimitedStore(memory, &sessions.LimitOptions{MaxSessions: 2})
+		assert.Nil(save(store, "de"))
+	})
+}
+
+func TestTieredStore(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	t.Run("TieredStore with write-through that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		memory := sessions.NewMemoryStore()
+		defer memory.Close()
+		backend := &countingStore{Store: memory}
+		store := sessions.NewTieredStore(backend, nil)
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Age = useage
+			assert.Nil(session.Save())
+			assert.True(session.GetSID() != "")
+		})
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(int32(1), atomic.LoadInt32(&backend.saves))
+		assert.Equal(1, memory.Len())
+
+		//====== reuse session from the local cache =====
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal(username, session.Name)
+			assert.Equal(useage, session.Age)
+			assert.False(session.IsNew())
+			// unchanged session is not written again
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(int32(1), atomic.LoadInt32(&backend.loads))
+		assert.Equal(int32(1), atomic.LoadInt32(&backend.saves))
+
+		//====== destroy invalidates both tiers =====
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Nil(session.Destroy())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(0, store.Len())
+		assert.Equal(0, memory.Len())
+
+		//====== unknown sid is cached as missing =====
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Equal("", session.Name)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(int32(2), atomic.LoadInt32(&backend.loads))
+	})
+
+	t.Run("TieredStore with expired local entries that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		memory := sessions.NewMemoryStore()
+		defer memory.Close()
+		backend := &countingStore{Store: memory}
+		clock := sessionstest.NewFakeClock(time.Now())
+		store := sessions.NewTieredStore(backend, &sessions.TieredOptions{
+			LocalTTL: time.Second,
+			Clock:    clock,
+		})
+		defer store.Close()
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(store.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal(username, session.Name)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(int32(1), atomic.LoadInt32(&backend.loads))
+
+		clock.Advance(time.Second * 2)
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+		assert.Equal(int32(2), atomic.LoadInt32(&backend.loads))
+	})
+
+	t.Run("TieredStore with write-back that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		memory := sessions.NewMemoryStore()
+		defer memory.Close()
+		backend := &countingStore{Store: memory}
+		store := sessions.NewTieredStore(backend, &sessions.TieredOptions{
+			WriteBack:     true,
+			FlushInterval: time.Hour,
+		})
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			session.Age = useage
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+		assert.Equal(int32(0), atomic.LoadInt32(&backend.saves))
+		assert.Equal(0, memory.Len())
+
+		assert.Nil(store.Flush())
+		assert.Equal(int32(1), atomic.LoadInt32(&backend.saves))
+		assert.Equal(1, memory.Len())
+		store.Close()
+
+		//====== the backend serves the flushed session =====
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			assert.Nil(memory.Load(SessionName, session, cookie.New(w, r, SessionKeys...)))
+			assert.Equal(username, session.Name)
+			assert.Equal(useage, session.Age)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	})
+
+	t.Run("TieredStore Destroy during a write-back flush that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		memory := sessions.NewMemoryStore()
+		defer memory.Close()
+		backend := &blockingStore{Store: memory, saving: make(chan struct{}, 1), release: make(chan struct{})}
+		store := sessions.NewTieredStore(backend, &sessions.TieredOptions{
+			WriteBack:     true,
+			FlushInterval: time.Hour,
+		})
+
+		req, _ := http.NewRequest("GET", "/", nil)
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			session.Name = username
+			assert.Nil(session.Save())
+		})
+		handler.ServeHTTP(recorder, req)
+
+		flushed := make(chan error)
+		go func() {
+			flushed <- store.Flush()
+		}()
+		<-backend.saving
+
+		req, _ = http.NewRequest("GET", "/", nil)
+		migrateCookies(recorder, req)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Equal(username, session.Name)
+			assert.Nil(session.Destroy())
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		close(backend.release)
+		assert.Nil(<-flushed)
+		assert.Equal(0, memory.Len())
+
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &Session{Meta: &sessions.Meta{}}
+			store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			assert.Equal("", session.Name)
+		})
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		store.Close()
+		assert.NotPanics(store.Close)
+	})
+}
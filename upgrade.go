@@ -0,0 +1,117 @@
+package sessions
+
+import "reflect"
+
+// MergeStore is a store Upgrade can merge guest sessions into the existing
+// session of their user with, such as MemoryStore.
+type MergeStore interface {
+	OwnerIndex
+	// IDOf returns the SessionInfo id of sid.
+	IDOf(sid string) string
+	// UpdateID applies fn to the session of id, as found in SessionInfo,
+	// and saves it, see MemoryStore.Update.
+	UpdateID(id string, newSession func() Sessions, fn func(Sessions) error) error
+}
+
+// Upgrade moves session, such as a guest's one whose user just signed in,
+// to a new sid, so that a sid planted before the sign-in can not be used
+// for session fixation. The session is saved under the new sid before the
+// old one is destroyed, and it is bound to the current client if it has a
+// Binding.
+//
+// If session implements Subjecter and its store is a MergeStore, such as
+// MemoryStore, the most recently used session of the subject is decoded
+// into newSession() and passed to merge with session, which copies what it
+// needs from session into it. That session is saved, so the user's other
+// browsers see the merged data, and session takes its value before moving
+// to the new sid. Other server stores only get the sid regenerated.
+func Upgrade(session Sessions, newSession func() Sessions, merge func(existing, session Sessions) error) (err error) {
+	if err = resolve(session); err != nil {
+		return
+	}
+	store := session.GetStore()
+	if s, ok := session.(Subjecter); ok && s.SubjectID() != "" && merge != nil {
+		if m, ok := store.(MergeStore); ok {
+			if err = mergeInto(m, session, s.SubjectID(), newSession, merge); err != nil {
+				return
+			}
+		}
+	}
+
+	sid := session.GetSID()
+	session.Init(session.GetName(), "", session.GetCookie(), store, "")
+	rebind(session)
+	if m, ok := session.(interface {
+		MarkChanged()
+	}); ok {
+		m.MarkChanged()
+	}
+	if err = store.Save(session); err != nil {
+		return
+	}
+	if sid != "" {
+		// the cookie now holds the new sid, leave it alone
+		old := &rawSession{Meta: &Meta{}}
+		old.Init(session.GetName(), sid, detachedCookie(), store, "")
+		err = store.Destroy(old)
+	}
+	return
+}
+
+// mergeInto merges session into the most recently used other session of
+// subject, if there is one, and decodes the merged value into session.
+func mergeInto(store MergeStore, session Sessions, subject string, newSession func() Sessions, merge func(existing, session Sessions) error) error {
+	infos, err := store.SessionsFor(subject)
+	if err != nil {
+		return err
+	}
+	own := ""
+	if sid := session.GetSID(); sid != "" {
+		own = store.IDOf(sid)
+	}
+	var latest *SessionInfo
+	for i := range infos {
+		if infos[i].ID != own && (latest == nil || infos[i].Accessed.After(latest.Accessed)) {
+			latest = &infos[i]
+		}
+	}
+	if latest == nil {
+		return nil
+	}
+
+	var merged Sessions
+	err = store.UpdateID(latest.ID, newSession, func(existing Sessions) error {
+		merged = existing
+		return merge(existing, session)
+	})
+	if err == ErrNotFound {
+		// gone meanwhile, nothing to merge into
+		return nil
+	} else if err != nil {
+		return err
+	}
+	value, err := Encode(merged)
+	if err != nil {
+		return err
+	}
+	resetFields(session)
+	return Decode(value, &session)
+}
+
+// resetFields zeroes the fields of session but its Meta, so that the ones
+// the merged value omits do not survive decoding it.
+func resetFields(session Sessions) {
+	v := reflect.ValueOf(session)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return
+	}
+	v = v.Elem()
+	meta := reflect.TypeOf(Meta{})
+	for i := 0; i < v.NumField(); i++ {
+		f := v.Field(i)
+		if t := f.Type(); t == meta || t == reflect.PtrTo(meta) || !f.CanSet() {
+			continue
+		}
+		f.Set(reflect.Zero(f.Type()))
+	}
+}
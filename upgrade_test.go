@@ -0,0 +1,184 @@
+package sessions_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-http-utils/cookie"
+	"github.com/go-http-utils/cookie-session"
+	"github.com/stretchr/testify/assert"
+)
+
+// CartSession holds a cart, for guests and signed-in users.
+type CartSession struct {
+	*sessions.Meta `json:"-"`
+	UserID         string   `json:"uid"`
+	Cart           []string `json:"cart"`
+	Guest          string   `json:"guest,omitempty"`
+}
+
+func (s *CartSession) Save() error {
+	return s.GetStore().Save(s)
+}
+
+func (s *CartSession) SubjectID() string {
+	return s.UserID
+}
+
+func TestUpgrade(t *testing.T) {
+
+	SessionName := "teambition"
+	SessionKeys := []string{"keyxxx"}
+
+	newSession := func() sessions.Sessions {
+		return &CartSession{Meta: &sessions.Meta{}}
+	}
+	merge := func(existing, session sessions.Sessions) error {
+		s := existing.(*CartSession)
+		s.Cart = append(s.Cart, session.(*CartSession).Cart...)
+		return nil
+	}
+	serve := func(store sessions.Store, from *httptest.ResponseRecorder, fn func(session *CartSession, err error)) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/", nil)
+		if from != nil {
+			migrateCookies(from, req)
+		}
+		recorder := httptest.NewRecorder()
+		handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			session := &CartSession{Meta: &sessions.Meta{}}
+			err := store.Load(SessionName, session, cookie.New(w, r, SessionKeys...))
+			fn(session, err)
+		})
+		handler.ServeHTTP(recorder, req)
+		return recorder
+	}
+
+	t.Run("Upgrade with merge that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+
+		user := serve(store, nil, func(session *CartSession, err error) {
+			session.UserID = "u1"
+			session.Cart = []string{"book"}
+			session.Save()
+		})
+		guest := serve(store, nil, func(session *CartSession, err error) {
+			session.Cart = []string{"pen"}
+			session.Save()
+		})
+		guestSID, _ := getCookie(SessionName, guest)
+
+		upgraded := serve(store, guest, func(session *CartSession, err error) {
+			session.UserID = "u1"
+			assert.Nil(sessions.Upgrade(session, newSession, merge))
+		})
+		sid, _ := getCookie(SessionName, upgraded)
+		assert.NotEqual(guestSID.Value, sid.Value)
+		assert.Equal(2, store.Len())
+
+		serve(store, upgraded, func(session *CartSession, err error) {
+			assert.Nil(err)
+			assert.Equal("u1", session.UserID)
+			assert.Equal([]string{"book", "pen"}, session.Cart)
+		})
+		serve(store, guest, func(session *CartSession, err error) {
+			assert.Equal("", session.UserID)
+			assert.Nil(session.Cart)
+		})
+		// the user stays signed in on their other browser, with the merged cart
+		serve(store, user, func(session *CartSession, err error) {
+			assert.Nil(err)
+			assert.Equal("u1", session.UserID)
+			assert.Equal([]string{"book", "pen"}, session.Cart)
+		})
+	})
+
+	t.Run("Upgrade dropping guest fields that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		store := sessions.NewMemoryStore()
+		defer store.Close()
+
+		serve(store, nil, func(session *CartSession, err error) {
+			session.UserID = "u1"
+			session.Cart = []string{"book"}
+			session.Save()
+		})
+		guest := serve(store, nil, func(session *CartSession, err error) {
+			session.Guest = "temp"
+			session.Cart = []string{"pen"}
+			session.Save()
+		})
+
+		upgraded := serve(store, guest, func(session *CartSession, err error) {
+			session.UserID = "u1"
+			assert.Nil(sessions.Upgrade(session, newSession, merge))
+			assert.Equal("", session.Guest)
+			assert.Equal([]string{"book", "pen"}, session.Cart)
+		})
+		serve(store, upgraded, func(session *CartSession, err error) {
+			assert.Nil(err)
+			assert.Equal("", session.Guest)
+			assert.Equal([]string{"book", "pen"}, session.Cart)
+		})
+	})
+
+	t.Run("Upgrade failing to save that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		server := newFakeRedis(t)
+		defer server.Close()
+		store := sessions.NewRedisStore(&sessions.RedisOptions{Addr: server.Addr()})
+		defer store.Close()
+
+		guest := serve(store, nil, func(session *CartSession, err error) {
+			session.Cart = []string{"pen"}
+			session.Save()
+		})
+		server.lock.Lock()
+		server.failSet = true
+		server.lock.Unlock()
+		serve(store, guest, func(session *CartSession, err error) {
+			session.UserID = "u1"
+			assert.NotNil(sessions.Upgrade(session, newSession, merge))
+		})
+		server.lock.Lock()
+		server.failSet = false
+		server.lock.Unlock()
+
+		// the old sid is only destroyed once the new one is saved
+		serve(store, guest, func(session *CartSession, err error) {
+			assert.Nil(err)
+			assert.Equal([]string{"pen"}, session.Cart)
+		})
+	})
+
+	t.Run("Upgrade without existing session that should be", func(t *testing.T) {
+		assert := assert.New(t)
+		server := newFakeRedis(t)
+		defer server.Close()
+		store := sessions.NewRedisStore(&sessions.RedisOptions{Addr: server.Addr()})
+		defer store.Close()
+
+		guest := serve(store, nil, func(session *CartSession, err error) {
+			session.Cart = []string{"pen"}
+			session.Save()
+		})
+		guestSID, _ := getCookie(SessionName, guest)
+		upgraded := serve(store, guest, func(session *CartSession, err error) {
+			session.UserID = "u1"
+			assert.Nil(sessions.Upgrade(session, newSession, merge))
+		})
+		sid, _ := getCookie(SessionName, upgraded)
+		assert.NotEqual(guestSID.Value, sid.Value)
+
+		serve(store, upgraded, func(session *CartSession, err error) {
+			assert.Equal("u1", session.UserID)
+			assert.Equal([]string{"pen"}, session.Cart)
+		})
+		serve(store, guest, func(session *CartSession, err error) {
+			assert.Equal("", session.UserID)
+			assert.Nil(session.Cart)
+		})
+	})
+}